@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// runFeedback handles "feedback good|bad <tx hash>", which records whether the
+// stored messages of a transaction are real messages, for autotune to learn
+// the thresholds from.
+func runFeedback(args []string) {
+	fs := flag.NewFlagSet("feedback", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	text := fs.String("text", "", "only the message with this text (default: every message of the transaction)")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+	verdict, h := fs.Arg(0), fs.Arg(1)
+	if fs.NArg() != 2 || (verdict != "good" && verdict != "bad") || !isHexHash(h) {
+		fatalf(exitUsage, "usage: feedback [-db file] [-chain name] [-text message] good|bad <tx hash>")
+	}
+
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	ctx := context.Background()
+
+	hash := common.HexToHash(h)
+	msgs, err := st.Query(ctx, store.Query{TxHash: &hash})
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	if *text != "" {
+		var matched []txmsg.Message
+		for _, msg := range msgs {
+			if msg.Text == *text {
+				matched = append(matched, msg)
+			}
+		}
+		msgs = matched
+	}
+	if len(msgs) == 0 {
+		fatalf(exitFailure, "No stored message in tx %s matches", h)
+	}
+	if err := st.SetFeedback(ctx, msgs, verdict == "good"); err != nil {
+		fatalf(exitStore, "Store error: %v", err)
+	}
+	fmt.Printf("Marked %d messages %s\n", len(msgs), verdict)
+}
+
+// Ranges searched by autotune.
+var (
+	tuneMinWords      = []int{1, 2, 3, 4, 5}
+	tuneMinWordLength = []int{1, 2, 3, 4, 5}
+	tuneLetterRatios  = []float64{0.3, 0.35, 0.4, 0.45, 0.5, 0.55, 0.6, 0.65, 0.7, 0.75, 0.8, 0.85, 0.9, 0.95}
+)
+
+// runAutotune searches the heuristic thresholds for the ones agreeing best
+// with the recorded feedback (good messages accepted, bad ones rejected) and
+// writes them as a configuration profile. Ties go to the thresholds closest to
+// the chain's current ones.
+func runAutotune(args []string) {
+	fs := flag.NewFlagSet("autotune", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	out := fs.String("out", "", "file to write the suggested configuration to (default: standard output)")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	current, ok := chainOpts.scanner().Validators[0].(txmsg.Heuristics)
+	if !ok {
+		fatalf(exitFailure, "The chain's scanner has no heuristics to tune")
+	}
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	fbs, err := st.Feedback(context.Background())
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	if len(fbs) == 0 {
+		fatalf(exitFailure, "No feedback recorded; mark messages with feedback good|bad first")
+	}
+
+	best, bestScore := current, agreement(current, fbs)
+	currentScore := bestScore
+	for _, minWords := range tuneMinWords {
+		for _, minWordLength := range tuneMinWordLength {
+			for _, ratio := range tuneLetterRatios {
+				for _, skipVowels := range []bool{false, true} {
+					h := txmsg.Heuristics{MinWords: minWords, MinWordLength: minWordLength, LetterRatio: ratio, SkipVowelCheck: skipVowels}
+					score := agreement(h, fbs)
+					if score > bestScore || (score == bestScore && tuneDistance(h, current) < tuneDistance(best, current)) {
+						best, bestScore = h, score
+					}
+				}
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Current thresholds agree with %d of %d verdicts; suggested thresholds agree with %d\n",
+		currentScore, len(fbs), bestScore)
+
+	// Start from the chain's profile so its preset and minimum length are
+	// kept, and override only the tuned thresholds.
+	var hc HeuristicsConfig
+	if loaded := chainOpts.loadConfig().heuristicsFor(chainOpts.lookup()); loaded != nil {
+		hc = *loaded
+	}
+	hc.MinWords, hc.MinWordLength = &best.MinWords, &best.MinWordLength
+	hc.LetterRatio, hc.SkipVowelCheck = &best.LetterRatio, &best.SkipVowelCheck
+	profile := struct {
+		Heuristics *HeuristicsConfig `json:"heuristics"`
+	}{&hc}
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		fatalf(exitFailure, "Encode error: %v", err)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		fatalf(exitFailure, "Write error: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s; copy its heuristics section into %s to use it\n", *out, *chainOpts.config)
+}
+
+// agreement returns how many verdicts h agrees with.
+func agreement(h txmsg.Heuristics, fbs []store.Feedback) int {
+	n := 0
+	for _, fb := range fbs {
+		if h.Valid(fb.Text) == fb.Good {
+			n++
+		}
+	}
+	return n
+}
+
+// tuneDistance measures how far apart two sets of thresholds are, a letter
+// ratio step of 0.05 counting as much as one word.
+func tuneDistance(a, b txmsg.Heuristics) float64 {
+	d := math.Abs(float64(a.MinWords-b.MinWords)) +
+		math.Abs(float64(a.MinWordLength-b.MinWordLength)) +
+		math.Abs(a.LetterRatio-b.LetterRatio)/0.05
+	if a.SkipVowelCheck != b.SkipVowelCheck {
+		d++
+	}
+	return d
+}
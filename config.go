@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/joho/godotenv"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// Config is the optional configuration file.
+type Config struct {
+	Chains     []*Chain          `json:"chains"` // Added to (or replacing, by name) the built-in chains
+	Heuristics *HeuristicsConfig `json:"heuristics"`
+	Contacts   *bool             `json:"contacts"` // Extract email addresses, handles and phone numbers; true if unset
+	Labels     map[string]string `json:"labels"`   // Names of known addresses, e.g. exploiters or exchanges
+	Selectors  *SelectorsConfig  `json:"selectors"`
+}
+
+// SelectorsConfig adjusts the known function selectors, whose calls are
+// skipped rather than decoded. Selectors are 8 hex digits, with or without 0x.
+type SelectorsConfig struct {
+	Allow []string          `json:"allow"` // Known selectors to decode anyway, e.g. ones that spell common text
+	Block map[string]string `json:"block"` // More selectors to skip, with a description of each
+}
+
+// HeuristicsConfig selects the detection thresholds: a preset, with any of its
+// values overridden.
+type HeuristicsConfig struct {
+	Preset         string   `json:"preset,omitempty"`    // strict, balanced (default) or lenient
+	MinLength      *int     `json:"minLength,omitempty"` // Shortest run of text the decoder considers
+	MinWords       *int     `json:"minWords,omitempty"`
+	MinWordLength  *int     `json:"minWordLength,omitempty"`
+	LetterRatio    *float64 `json:"letterRatio,omitempty"`
+	SkipVowelCheck *bool    `json:"skipVowelCheck,omitempty"`
+}
+
+// Chain describes an EVM chain the scanner can connect to.
+type Chain struct {
+	Name      string   `json:"name"`
+	ChainID   uint64   `json:"chainId"` // Checked against the endpoint on connect; 0 skips the check
+	RPC       string   `json:"rpc"`     // Endpoint URL; ${VAR} is expanded from the environment and .env
+	Explorer  Explorer `json:"explorer"`
+	Currency  string   `json:"currency"`  // Native currency symbol
+	Decimals  int      `json:"decimals"`  // Native currency decimals, 18 if unset
+	BlockTime duration `json:"blockTime"` // Expected block interval, e.g. "12s"; 0 if blocks are irregular
+
+	Heuristics *HeuristicsConfig `json:"heuristics"` // Detection profile for this chain, overriding the global one
+}
+
+// UnmarshalJSON implements json.Unmarshaler, defaulting Decimals to 18 when the
+// field is absent. An explicit 0 is kept, for chains whose native unit is
+// indivisible.
+func (c *Chain) UnmarshalJSON(data []byte) error {
+	type plain Chain // Without this method
+	p := plain{Decimals: 18}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = Chain(p)
+	return nil
+}
+
+// Explorer holds a chain's block explorer link templates. {tx}, {address} and
+// {block} are replaced with the transaction hash, address and block number;
+// an empty template means no link.
+type Explorer struct {
+	Tx      string `json:"tx"`
+	Address string `json:"address"`
+	Block   string `json:"block"`
+}
+
+// etherscanStyle returns the templates of an Etherscan-family explorer at base.
+func etherscanStyle(base string) Explorer {
+	return Explorer{
+		Tx:      base + "/tx/{tx}",
+		Address: base + "/address/{address}",
+		Block:   base + "/block/{block}",
+	}
+}
+
+// builtinChains are available without a configuration file.
+var builtinChains = []*Chain{
+	{
+		Name:      "mainnet",
+		ChainID:   1,
+		RPC:       "wss://mainnet.infura.io/ws/v3/${INFURA_KEY}",
+		Explorer:  etherscanStyle("https://etherscan.io"),
+		Currency:  "ETH",
+		Decimals:  18,
+		BlockTime: duration(12 * time.Second),
+	},
+	{
+		Name:      "base",
+		ChainID:   8453,
+		RPC:       "wss://base-mainnet.infura.io/ws/v3/${INFURA_KEY}",
+		Explorer:  etherscanStyle("https://basescan.org"),
+		Currency:  "ETH",
+		Decimals:  18,
+		BlockTime: duration(2 * time.Second),
+	},
+	{
+		Name:      "polygon",
+		ChainID:   137,
+		RPC:       "wss://polygon-mainnet.infura.io/ws/v3/${INFURA_KEY}",
+		Explorer:  etherscanStyle("https://polygonscan.com"),
+		Currency:  "POL",
+		Decimals:  18,
+		BlockTime: duration(2 * time.Second),
+	},
+	{
+		// Local Anvil or Hardhat node. Blocks are mined on demand, so there is
+		// no block time to detect a stalled subscription with.
+		Name:     "anvil",
+		ChainID:  31337,
+		RPC:      "ws://127.0.0.1:8545",
+		Currency: "ETH",
+		Decimals: 18,
+	},
+}
+
+// chainProfiles are the detection profiles used for chains, by chain ID,
+// unless the configuration file sets heuristics. Chains flooded with
+// inscription and token spam need stricter thresholds than mainnet.
+var chainProfiles = map[uint64]*HeuristicsConfig{
+	56:   {Preset: "strict"}, // BNB Smart Chain
+	137:  {Preset: "strict"}, // Polygon
+	8453: {Preset: "strict"}, // Base
+}
+
+// duration is a time.Duration that reads and writes as a string like "12s".
+type duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// loadConfig reads the configuration file at path. A missing file yields an
+// empty configuration.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if _, err := newScanner(cfg.Heuristics); err != nil {
+		return nil, fmt.Errorf("%s: heuristics: %w", path, err)
+	}
+	// Key labels by lowercase address so lookups don't depend on checksum casing.
+	labels := make(map[string]string, len(cfg.Labels))
+	for addr, label := range cfg.Labels {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("%s: label %q: invalid address %q", path, label, addr)
+		}
+		labels[strings.ToLower(common.HexToAddress(addr).Hex())] = label
+	}
+	cfg.Labels = labels
+	if err := cfg.Selectors.normalize(); err != nil {
+		return nil, fmt.Errorf("%s: selectors: %w", path, err)
+	}
+	for i, c := range cfg.Chains {
+		if c.Name == "" {
+			return nil, fmt.Errorf("%s: chain %d has no name", path, i)
+		}
+		if _, err := newScanner(c.Heuristics); err != nil {
+			return nil, fmt.Errorf("%s: chain %s heuristics: %w", path, c.Name, err)
+		}
+		if c.Decimals < 0 {
+			return nil, fmt.Errorf("%s: chain %s has negative decimals %d", path, c.Name, c.Decimals)
+		}
+	}
+	return cfg, nil
+}
+
+// heuristicsFor returns the detection profile for c: the chain's own
+// heuristics, else the global ones, else the built-in profile for its chain
+// ID. It is nil if c uses the defaults.
+func (cfg *Config) heuristicsFor(c *Chain) *HeuristicsConfig {
+	if c.Heuristics != nil {
+		return c.Heuristics
+	}
+	if cfg.Heuristics != nil {
+		return cfg.Heuristics
+	}
+	return chainProfiles[c.ChainID]
+}
+
+// scannerFor returns a scanner using the detection profile for c, or the
+// defaults if it has none.
+func (cfg *Config) scannerFor(c *Chain) (*txmsg.Scanner, error) {
+	s, err := newScanner(cfg.heuristicsFor(c))
+	if err != nil {
+		return nil, err
+	}
+	s.SkipContacts = cfg.Contacts != nil && !*cfg.Contacts
+	cfg.Selectors.apply(s)
+	return s, nil
+}
+
+// newScanner returns a scanner using the heuristics hc, or the defaults if
+// hc is nil.
+func newScanner(hc *HeuristicsConfig) (*txmsg.Scanner, error) {
+	s := txmsg.NewScanner()
+	if hc == nil {
+		return s, nil
+	}
+
+	h := txmsg.DefaultHeuristics
+	if hc.Preset != "" {
+		var ok bool
+		if h, ok = txmsg.HeuristicPresets[hc.Preset]; !ok {
+			return nil, fmt.Errorf("unknown preset %q", hc.Preset)
+		}
+	}
+	if hc.MinWords != nil {
+		h.MinWords = *hc.MinWords
+	}
+	if hc.MinWordLength != nil {
+		h.MinWordLength = *hc.MinWordLength
+	}
+	if hc.LetterRatio != nil {
+		h.LetterRatio = *hc.LetterRatio
+	}
+	if hc.SkipVowelCheck != nil {
+		h.SkipVowelCheck = *hc.SkipVowelCheck
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	s.Validators = []txmsg.Validator{h}
+
+	if hc.MinLength != nil {
+		if *hc.MinLength < 1 {
+			return nil, fmt.Errorf("minimum length %d must be at least 1", *hc.MinLength)
+		}
+		// Every text decoder, including the large-payload one, so that a
+		// message isn't found or missed depending on the size of its calldata.
+		for i, d := range s.Decoders {
+			if _, ok := d.(*txmsg.UTF8Decoder); ok {
+				s.Decoders[i] = txmsg.NewUTF8Decoder(*hc.MinLength)
+			}
+		}
+		for i, d := range s.LargeDecoders {
+			if _, ok := d.(*txmsg.StreamDecoder); ok {
+				s.LargeDecoders[i] = txmsg.NewStreamDecoder(*hc.MinLength)
+			}
+		}
+	}
+	return s, nil
+}
+
+// label returns the configured name of addr, or "" if it has none.
+func (cfg *Config) label(addr common.Address) string {
+	return cfg.Labels[strings.ToLower(addr.Hex())]
+}
+
+// chain returns the chain called name, preferring the configuration file over
+// the built-in chains.
+func (cfg *Config) chain(name string) (*Chain, bool) {
+	for _, c := range cfg.Chains {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	for _, c := range builtinChains {
+		if c.Name == name {
+			copied := *c
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+// allChains returns the configured chains followed by the built-in ones they
+// don't replace.
+func (cfg *Config) allChains() []*Chain {
+	chains := slices.Clone(cfg.Chains)
+	for _, c := range builtinChains {
+		if !slices.ContainsFunc(cfg.Chains, func(d *Chain) bool { return d.Name == c.Name }) {
+			copied := *c
+			chains = append(chains, &copied)
+		}
+	}
+	return chains
+}
+
+// selectChains returns the chains named in spec, a comma-separated list, or
+// for "all" every chain that has a database here; it exits if a name is
+// unknown or no chain qualifies.
+func (cfg *Config) selectChains(spec string) []*Chain {
+	var chains []*Chain
+	if spec == "all" {
+		for _, c := range cfg.allChains() {
+			if _, err := os.Stat(c.file(storeFile)); err == nil {
+				chains = append(chains, c)
+			}
+		}
+		if len(chains) == 0 {
+			fatalf(exitUsage, "No chain has a database here yet")
+		}
+		return chains
+	}
+	for _, name := range strings.Split(spec, ",") {
+		c, ok := cfg.chain(strings.TrimSpace(name))
+		if !ok {
+			fatalf(exitUsage, "Unknown chain %q", name)
+		}
+		chains = append(chains, c)
+	}
+	return chains
+}
+
+// chainOptions are the flags selecting the configuration file and the chain
+// to connect to.
+type chainOptions struct {
+	config *string
+	chain  *string
+	rpcURL *string
+	cfg    *Config // Loaded on first use
+}
+
+// dbUsage describes the -db flag of commands that select a chain.
+const dbUsage = "message database (default txmsg.db on mainnet, txmsg-<chain>.db on other chains)"
+
+// addChainFlags registers -config, -chain and -rpc-url on fs, selecting
+// defaultChain unless -chain is given.
+func addChainFlags(fs *flag.FlagSet, defaultChain string) *chainOptions {
+	return &chainOptions{
+		config: fs.String("config", configFile, "configuration file"),
+		chain:  fs.String("chain", defaultChain, "chain to scan, built in or defined in the configuration file"),
+		rpcURL: fs.String("rpc-url", "", "RPC endpoint overriding the chain's"),
+	}
+}
+
+// loadConfig returns the configuration file, exiting if it is invalid.
+func (o *chainOptions) loadConfig() *Config {
+	if o.cfg == nil {
+		cfg, err := loadConfig(*o.config)
+		if err != nil {
+			fatalf(exitFailure, "Config error: %v", err)
+		}
+		o.cfg = cfg
+	}
+	return o.cfg
+}
+
+// scanner returns a scanner using the detection profile of the selected chain,
+// which records its provenance and chain ID on the messages it finds.
+func (o *chainOptions) scanner() *txmsg.Scanner {
+	c := o.lookup()
+	s, err := o.loadConfig().scannerFor(c)
+	if err != nil {
+		fatalf(exitFailure, "Config error: %v", err) // already validated by loadConfig
+	}
+	rpc := c.RPC
+	if *o.rpcURL != "" {
+		rpc = *o.rpcURL
+	}
+	s.Provenance = txmsg.NewProvenance(s, buildVersion(), providerHost(rpc))
+	s.ChainID = c.ChainID
+	return s
+}
+
+// lookup returns the selected chain without touching its RPC endpoint,
+// exiting if it can't be found.
+func (o *chainOptions) lookup() *Chain {
+	c, ok := o.loadConfig().chain(*o.chain)
+	if !ok {
+		fatalf(exitUsage, "Unknown chain %q", *o.chain)
+	}
+	return c
+}
+
+// dbPath returns path, or the selected chain's own database if path is empty.
+func (o *chainOptions) dbPath(path string) string {
+	if path != "" {
+		return path
+	}
+	return o.lookup().file(storeFile)
+}
+
+// resolve returns the selected chain with its RPC URL expanded, exiting if it
+// can't be found or configured.
+func (o *chainOptions) resolve() *Chain {
+	c := o.lookup()
+	if *o.rpcURL != "" {
+		c.RPC = *o.rpcURL
+	}
+	c.RPC = expandEnv(c.RPC)
+	if c.RPC == "" {
+		fatalf(exitFailure, "Chain %q has no RPC endpoint; set one in %s or pass -rpc-url", c.Name, *o.config)
+	}
+	return c
+}
+
+// expandEnv expands ${VAR} references in s, loading .env first if s has any.
+// A referenced variable that isn't set is fatal.
+func expandEnv(s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	// Load environment variables
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatalf(exitFailure, "Error loading .env file")
+	}
+	return os.Expand(s, func(name string) string {
+		v := os.Getenv(name)
+		if v == "" {
+			fatalf(exitFailure, "%s not found in environment or .env file", name)
+		}
+		return v
+	})
+}
+
+// dial connects to the chain's RPC endpoint and checks that it serves the
+// expected chain, exiting on failure.
+func (c *Chain) dial() *ethclient.Client {
+	client, err := ethclient.Dial(c.RPC)
+	if err != nil {
+		fatalf(exitProvider, "Connection error: %v", err)
+	}
+	if err := c.checkID(context.Background(), client); err != nil {
+		fatalf(exitProvider, "%v", err)
+	}
+	return client
+}
+
+// checkID verifies that client is connected to the chain with c's chain ID.
+func (c *Chain) checkID(ctx context.Context, client *ethclient.Client) error {
+	if c.ChainID == 0 {
+		return nil
+	}
+	id, err := client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("chain ID: %w", err)
+	}
+	if id.Uint64() != c.ChainID {
+		return fmt.Errorf("endpoint for %s serves chain ID %d, expected %d", c.Name, id, c.ChainID)
+	}
+	return nil
+}
+
+// file returns the name of the chain's own copy of a state file: name itself
+// on mainnet, which kept the original names, and name with the chain's name
+// before the extension on other chains, e.g. txmsg-base.db. Scans of different
+// chains thus never share a checkpoint, manifest or skipped-block ledger.
+func (c *Chain) file(name string) string {
+	if c.Name == "mainnet" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + c.Name + ext
+}
+
+// txURL returns the explorer link for a transaction, or "" if the chain has none.
+func (c *Chain) txURL(hash string) string {
+	return strings.ReplaceAll(c.Explorer.Tx, "{tx}", hash)
+}
+
+// addressURL returns the explorer link for an address, or "" if the chain has none.
+func (c *Chain) addressURL(addr string) string {
+	return strings.ReplaceAll(c.Explorer.Address, "{address}", addr)
+}
+
+// blockURL returns the explorer link for a block, or "" if the chain has none.
+func (c *Chain) blockURL(num uint64) string {
+	return strings.ReplaceAll(c.Explorer.Block, "{block}", strconv.FormatUint(num, 10))
+}
+
+// formatValue formats an amount of the smallest unit (wei) in the native
+// currency, e.g. "0.25 ETH".
+func (c *Chain) formatValue(v *big.Int) string {
+	if v == nil {
+		v = new(big.Int)
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(c.Decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(v, unit, new(big.Int))
+	s := whole.String()
+	if frac.Sign() != 0 {
+		digits := fmt.Sprintf("%0*s", c.Decimals, frac.String())
+		s += "." + strings.TrimRight(digits, "0")
+	}
+	if c.Currency != "" {
+		s += " " + c.Currency
+	}
+	return s
+}
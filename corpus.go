@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// corpusEntry is a historical transaction pinned in the golden corpus, together
+// with the messages the heuristics detected in it when it was last accepted.
+// An empty Messages list pins a known false positive that must stay rejected.
+type corpusEntry struct {
+	Tx       string   `json:"tx"`
+	Note     string   `json:"note,omitempty"`
+	Data     string   `json:"data"`
+	Messages []string `json:"messages"`
+}
+
+// corpus is the golden corpus file. Version is bumped every time the expected
+// detections change, so diffs of the file show when detection quality moved.
+type corpus struct {
+	Version int           `json:"version"`
+	Entries []corpusEntry `json:"entries"`
+}
+
+// loadCorpus reads the corpus at path. A missing file yields an empty corpus.
+func loadCorpus(path string) (*corpus, error) {
+	c := &corpus{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// save writes the corpus to path.
+func (c *corpus) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// put adds e to the corpus, replacing any existing entry for the same tx.
+func (c *corpus) put(e corpusEntry) {
+	for i, old := range c.Entries {
+		if old.Tx == e.Tx {
+			if e.Note == "" {
+				e.Note = old.Note
+			}
+			c.Entries[i] = e
+			return
+		}
+	}
+	c.Entries = append(c.Entries, e)
+}
+
+// runCorpus handles "corpus add", which fetches transactions once and pins
+// their calldata and current detections in the corpus file.
+func runCorpus(args []string) {
+	if len(args) == 0 || args[0] != "add" {
+		fatalf(exitUsage, "usage: corpus add [-corpus file] [-note text] <txhash>...")
+	}
+	fs := flag.NewFlagSet("corpus add", flag.ExitOnError)
+	path := fs.String("corpus", corpusFile, "corpus file")
+	note := fs.String("note", "", "why this transaction is in the corpus")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args[1:])
+	if fs.NArg() == 0 {
+		fatalf(exitUsage, "corpus add: no transaction hashes given")
+	}
+
+	c, err := loadCorpus(*path)
+	if err != nil {
+		fatalf(exitFailure, "Corpus error: %v", err)
+	}
+
+	client := chainOpts.resolve().dial()
+	scanner := txmsg.NewScanner()
+	for _, h := range fs.Args() {
+		if len(h) != 66 {
+			fatalf(exitUsage, "Invalid tx hash %q", h)
+		}
+		tx, _, err := client.TransactionByHash(context.Background(), common.HexToHash(h))
+		if err != nil {
+			fatalf(exitProvider, "Tx %s fetch error: %v", h, err)
+		}
+		msgs := messageTexts(scanner.ScanData(tx.Data()))
+		c.put(corpusEntry{
+			Tx:       tx.Hash().Hex(),
+			Note:     *note,
+			Data:     hexutil.Encode(tx.Data()),
+			Messages: msgs,
+		})
+		fmt.Printf("Added %s (%d messages)\n", tx.Hash().Hex(), len(msgs))
+	}
+
+	c.Version++
+	if err := c.save(*path); err != nil {
+		fatalf(exitFailure, "Corpus save error: %v", err)
+	}
+}
+
+// runCheck handles "check corpus", which re-runs the heuristics over every
+// corpus entry and exits non-zero if any detection changed. With -update the
+// new detections are accepted and the corpus version is bumped instead.
+func runCheck(args []string) {
+	if len(args) == 0 || args[0] != "corpus" {
+		fatalf(exitUsage, "usage: check corpus [-corpus file] [-update]")
+	}
+	fs := flag.NewFlagSet("check corpus", flag.ExitOnError)
+	path := fs.String("corpus", corpusFile, "corpus file")
+	update := fs.Bool("update", false, "accept the current detections as the new expectations")
+	parseFlags(fs, args[1:])
+
+	c, err := loadCorpus(*path)
+	if err != nil {
+		fatalf(exitFailure, "Corpus error: %v", err)
+	}
+	if len(c.Entries) == 0 {
+		fatalf(exitFailure, "Corpus %s is empty; add transactions with \"corpus add\"", *path)
+	}
+
+	changed := checkCorpus(c, txmsg.NewScanner())
+	if changed == 0 {
+		fmt.Printf("Corpus v%d: all %d entries unchanged\n", c.Version, len(c.Entries))
+		return
+	}
+	if *update {
+		c.Version++
+		if err := c.save(*path); err != nil {
+			fatalf(exitFailure, "Corpus save error: %v", err)
+		}
+		fmt.Printf("Corpus updated to v%d (%d entries changed)\n", c.Version, changed)
+		return
+	}
+	fmt.Printf("Corpus v%d: %d of %d entries changed\n", c.Version, changed, len(c.Entries))
+	os.Exit(exitFailure)
+}
+
+// checkCorpus re-analyzes every entry, prints the ones whose detections differ
+// and stores the new detections in c. It returns the number of changed entries.
+func checkCorpus(c *corpus, scanner *txmsg.Scanner) int {
+	changed := 0
+	for i, e := range c.Entries {
+		data, err := hexutil.Decode(e.Data)
+		if err != nil {
+			fatalf(exitFailure, "Corpus entry %s has bad data: %v", e.Tx, err)
+		}
+		got := messageTexts(scanner.ScanData(data))
+		if slices.Equal(got, e.Messages) {
+			continue
+		}
+		changed++
+		fmt.Printf("Tx: %s", e.Tx)
+		if e.Note != "" {
+			fmt.Printf(" (%s)", e.Note)
+		}
+		fmt.Println()
+		for _, msg := range e.Messages {
+			if !slices.Contains(got, msg) {
+				fmt.Printf("  - %q\n", msg)
+			}
+		}
+		for _, msg := range got {
+			if !slices.Contains(e.Messages, msg) {
+				fmt.Printf("  + %q\n", msg)
+			}
+		}
+		c.Entries[i].Messages = got
+	}
+	return changed
+}
+
+// messageTexts returns the text of each message. It never returns nil, so that
+// entries without detections encode as [] rather than null.
+func messageTexts(msgs []txmsg.Message) []string {
+	texts := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		texts = append(texts, msg.Text)
+	}
+	return texts
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/krbreyn/txmsg-r/store"
+)
+
+// coverageReport is the scanned-range coverage of a store, as printed by
+// coverage -json and served at /coverage.
+type coverageReport struct {
+	Ranges []store.Range `json:"ranges"`
+	Gaps   []store.Range `json:"gaps"`
+}
+
+// runCoverage prints which block ranges have been scanned into the store, with
+// which configuration and version, the gaps between them and a bar showing
+// both at a glance.
+func runCoverage(args []string) {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	width := fs.Int("width", 60, "width of the coverage bar")
+	asJSON := fs.Bool("json", false, "print the ranges and gaps as JSON")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	ranges, err := st.Coverage(context.Background())
+	if err != nil {
+		fatalf(exitFailure, "Coverage error: %v", err)
+	}
+	report := coverageReport{Ranges: ranges, Gaps: store.Gaps(ranges)}
+
+	if *asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			fatalf(exitFailure, "Output error: %v", err)
+		}
+		return
+	}
+	if len(ranges) == 0 {
+		fmt.Println("No scanned ranges recorded")
+		return
+	}
+	first, last := ranges[0].Start, ranges[0].End
+	for _, r := range ranges {
+		last = max(last, r.End)
+	}
+	missing := uint64(0)
+	for _, g := range report.Gaps {
+		missing += g.End - g.Start + 1
+	}
+	fmt.Printf("Blocks %d-%d: %d ranges, %d gaps (%d blocks missing)\n\n", first, last, len(ranges), len(report.Gaps),
+		missing)
+	for _, r := range ranges {
+		fmt.Printf("  %d-%d  config %s  version %s\n", r.Start, r.End, orNone(r.ConfigHash), orNone(r.Version))
+	}
+	if len(report.Gaps) > 0 {
+		fmt.Println("\nGaps:")
+		for _, g := range report.Gaps {
+			fmt.Printf("  %d-%d (%d blocks)\n", g.Start, g.End, g.End-g.Start+1)
+		}
+	}
+	fmt.Printf("\n[%s]\n%d%*d\n", coverageBar(first, last, report.Gaps, *width), first, *width+2-len(fmt.Sprint(first)), last)
+	fmt.Println("# scanned, + partly scanned, . not scanned")
+}
+
+// coverageBar draws blocks first to last in width cells: # for cells that were
+// scanned entirely, + for partly and . for not at all.
+func coverageBar(first, last uint64, gaps []store.Range, width int) string {
+	span := last - first + 1
+	width = int(min(uint64(max(width, 1)), span))
+	var b strings.Builder
+	for i := range width {
+		lo := first + span*uint64(i)/uint64(width)
+		hi := first + span*uint64(i+1)/uint64(width) - 1
+		var missing uint64
+		for _, g := range gaps {
+			if g.End >= lo && g.Start <= hi {
+				missing += min(g.End, hi) - max(g.Start, lo) + 1
+			}
+		}
+		switch {
+		case missing == 0:
+			b.WriteByte('#')
+		case missing < hi-lo+1:
+			b.WriteByte('+')
+		default:
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+// orNone returns s, or "none" if it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// The demo blocks start at demoBlock, mined every 12 seconds from demoTime.
+const (
+	demoBlock = 19_000_000
+	demoTime  = 1_704_067_200 // 2024-01-01 00:00:00 UTC
+)
+
+// demoAddresses are the made-up accounts of the demo data.
+var demoAddresses = []common.Address{
+	common.HexToAddress("0x00000000000000000000000000000000000de0a1"),
+	common.HexToAddress("0x00000000000000000000000000000000000de0a2"),
+	common.HexToAddress("0x00000000000000000000000000000000000de0a3"),
+	common.HexToAddress("0x00000000000000000000000000000000000de0a4"),
+}
+
+// demoTx is a sample transaction: calldata from one demo address to another.
+type demoTx struct {
+	from, to int // Indexes into demoAddresses
+	data     string
+}
+
+// demoTxs are the bundled sample transactions, one per block. They cover what
+// the API shows: plain notes, contact details, a message repeated by another
+// sender, and calls that aren't messages at all.
+var demoTxs = []demoTx{
+	{0, 1, "gm, hope the move went well. Lunch next week?"},
+	{2, 3, "Hello, we noticed the exploit on your vault. Contact us at whitehat@example.com to arrange the return of funds"},
+	{3, 2, "Thanks for reaching out. We agree to a ten percent bounty, please send the rest back to this address"},
+	{1, 0, "Happy new year from the other side of the world"},
+	{0, 3, "\xa9\x05\x9c\xbb not a message, just a token transfer"},
+	{2, 1, "Never send funds to the address in this transaction, it is a scam"},
+	{3, 0, "Hello, we noticed the exploit on your vault. Contact us at whitehat@example.com to arrange the return of funds"},
+	{1, 2, "\x00\x01\x02\x03\xde\xad\xbe\xef 7f3a 9c1e 00ff 12ab"},
+	{0, 2, "Testing the message scanner end to end"},
+}
+
+// runDemo serves the API over bundled sample data held in memory, without a
+// database file, RPC endpoint or any other outside connection, to explore it
+// before configuring a provider.
+func runDemo(args []string) {
+	fs := flag.NewFlagSet("demo", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	parseFlags(fs, args)
+
+	st, err := store.OpenMemory()
+	if err != nil {
+		fatalf(exitStore, "Store error: %v", err)
+	}
+	defer st.Close()
+	n, err := loadDemo(context.Background(), st)
+	if err != nil {
+		fatalf(exitStore, "Store error: %v", err)
+	}
+
+	err = listenAndServe(*addr, serveHandler(st), func(addr net.Addr) {
+		log.Printf("Serving %d demo messages on http://%s, e.g. http://%s/messages", n, addr, addr)
+	})
+	if err != nil {
+		fatalf(exitFailure, "Server error: %v", err)
+	}
+}
+
+// loadDemo scans demoTxs with the default scanner and stores the messages
+// found, the coverage and the checkpoint as a scan would. It returns how many
+// messages were stored.
+func loadDemo(ctx context.Context, st *store.Store) (int, error) {
+	scanner := txmsg.NewScanner()
+	scanner.Provenance = txmsg.NewProvenance(scanner, buildVersion(), "demo")
+
+	var msgs []txmsg.Message
+	for i, tx := range demoTxs {
+		to := demoAddresses[tx.to]
+		found := scanner.ScanCall(txmsg.Call{
+			From:  demoAddresses[tx.from],
+			To:    &to,
+			Value: new(big.Int),
+			Data:  []byte(tx.data),
+		})
+		for _, msg := range found {
+			msg.TxHash = crypto.Keccak256Hash([]byte(fmt.Sprintf("txmsg-r demo %d", i)))
+			msg.Block = uint64(demoBlock + i)
+			msg.Time = uint64(demoTime + 12*i)
+			msgs = append(msgs, msg)
+		}
+	}
+	n, err := st.Save(ctx, msgs)
+	if err != nil {
+		return 0, err
+	}
+	last := uint64(demoBlock + len(demoTxs) - 1)
+	if err := st.AddCoverage(ctx, demoBlock, last, scanner.Provenance); err != nil {
+		return 0, err
+	}
+	return n, st.SetCheckpoint(ctx, last)
+}
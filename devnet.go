@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// devnetKey is the private key of the first account Anvil and Hardhat fund by
+// default. It is public knowledge; never use it on a real network.
+const devnetKey = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+
+// sampleMessages are posted by "devnet post" when no messages are given.
+var sampleMessages = []string{
+	"gm from the local devnet",
+	"Hello world, this is a test message",
+	"Testing the message scanner end to end",
+}
+
+// runDevnet handles "devnet post", which sends messages as transaction calldata
+// to a local test chain so the scanner can be exercised end to end.
+func runDevnet(args []string) {
+	if len(args) == 0 || args[0] != "post" {
+		fatalf(exitUsage, "usage: devnet post [-chain anvil] [-key hex] [message]...")
+	}
+	fs := flag.NewFlagSet("devnet post", flag.ExitOnError)
+	chainOpts := addChainFlags(fs, "anvil")
+	keyHex := fs.String("key", devnetKey, "private key of a funded account (default: the first Anvil/Hardhat account)")
+	parseFlags(fs, args[1:])
+
+	msgs := fs.Args()
+	if len(msgs) == 0 {
+		msgs = sampleMessages
+	}
+	key, err := crypto.HexToECDSA(*keyHex)
+	if err != nil {
+		fatalf(exitFailure, "Key error: %v", err)
+	}
+
+	client := chainOpts.resolve().dial()
+	defer client.Close()
+	for _, msg := range msgs {
+		tx, err := postMessage(client, key, msg)
+		if err != nil {
+			fatalf(exitFailure, "Post %q error: %v", msg, err)
+		}
+		fmt.Printf("%s %q\n", tx.Hash().Hex(), msg)
+	}
+}
+
+// postMessage sends msg as the calldata of a zero-value transaction from key's
+// account to itself and waits for it to be mined. Devnets that mine instantly
+// return as soon as the transaction is accepted.
+func postMessage(client *ethclient.Client, key *ecdsa.PrivateKey, msg string) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(msg)
+	gas, err := client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &from, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       &from,
+		Value:    new(big.Int),
+		Gas:      gas,
+		GasPrice: gasPrice,
+		Data:     data,
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, signed); err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := client.TransactionReceipt(ctx, signed.Hash()); err == nil {
+			return signed, nil
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for %s: %w", signed.Hash().Hex(), ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes. Commands exit with exitFailure for any failure without a more
+// specific code.
+const (
+	exitOK       = 0  // Completed
+	exitFailure  = 1  // Failed, e.g. on a bad configuration file
+	exitSkipped  = 2  // Completed, but some blocks couldn't be scanned; they are in the skipped-block ledger
+	exitProvider = 3  // The RPC endpoint couldn't be reached, served the wrong chain or failed a request
+	exitStore    = 4  // The message database couldn't be opened
+	exitUsage    = 64 // Invalid command line
+)
+
+// exitKinds name the exit codes in machine-readable error reports.
+var exitKinds = map[int]string{
+	exitFailure:  "failure",
+	exitSkipped:  "skipped",
+	exitProvider: "provider",
+	exitStore:    "store",
+	exitUsage:    "usage",
+}
+
+// errorsJSON makes fatal errors and partial failures print an errorReport to
+// standard error instead of a log line. Set with -errors-json.
+var errorsJSON bool
+
+// errorReport is the machine-readable form of an error that ends a command.
+type errorReport struct {
+	Code   int     `json:"code"`
+	Kind   string  `json:"kind"`
+	Error  string  `json:"error"`
+	Blocks []int64 `json:"blocks,omitempty"` // Blocks that couldn't be scanned
+}
+
+// fatalf reports an error and exits with code.
+func fatalf(code int, format string, args ...any) {
+	exitWith(errorReport{Code: code, Error: fmt.Sprintf(format, args...)})
+}
+
+// exitWith reports r, as JSON with -errors-json or as a log line otherwise, and
+// exits with its code.
+func exitWith(r errorReport) {
+	r.Kind = exitKinds[r.Code]
+	if errorsJSON {
+		json.NewEncoder(os.Stderr).Encode(r)
+	} else {
+		log.Print(r.Error)
+	}
+	os.Exit(r.Code)
+}
+
+// exitIfSkipped exits with exitSkipped if any blocks couldn't be scanned.
+func exitIfSkipped(blocks []int64) {
+	if len(blocks) > 0 {
+		exitWith(errorReport{
+			Code:   exitSkipped,
+			Error:  fmt.Sprintf("%d blocks couldn't be scanned", len(blocks)),
+			Blocks: blocks,
+		})
+	}
+}
+
+// parseFlags parses args into fs, adding the -errors-json flag every command
+// accepts. Invalid flags exit with exitUsage rather than the flag package's 2,
+// which means skipped blocks.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.BoolVar(&errorsJSON, "errors-json", false, "report fatal errors and skipped blocks as JSON on standard error")
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	}
+	if err != nil {
+		os.Exit(exitUsage) // the flag package has already printed the error and usage
+	}
+}
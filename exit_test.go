@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+)
+
+// exitCaseEnv names the case TestExitCodes runs in its child process.
+const exitCaseEnv = "TXMSG_EXIT_CASE"
+
+// runExitCase ends the process the way the named case does.
+func runExitCase(name string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	switch name {
+	case "fatal":
+		parseFlags(fs, []string{"-errors-json"})
+		fatalf(exitStore, "Store error: %s", "database is locked")
+	case "skipped":
+		parseFlags(fs, []string{"-errors-json"})
+		exitIfSkipped([]int64{3, 5})
+	case "nothing skipped":
+		parseFlags(fs, nil)
+		exitIfSkipped(nil)
+	case "bad flag":
+		parseFlags(fs, []string{"-no-such-flag"})
+	case "help":
+		parseFlags(fs, []string{"-h"})
+	}
+}
+
+// TestExitCodes runs each case in a child process and checks its exit code
+// and, with -errors-json, its report.
+func TestExitCodes(t *testing.T) {
+	if name := os.Getenv(exitCaseEnv); name != "" {
+		runExitCase(name)
+		os.Exit(exitOK)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		code   int
+		report *errorReport
+	}{
+		{"fatal", exitStore, &errorReport{Code: exitStore, Kind: "store", Error: "Store error: database is locked"}},
+		{"skipped", exitSkipped, &errorReport{Code: exitSkipped, Kind: "skipped", Error: "2 blocks couldn't be scanned", Blocks: []int64{3, 5}}},
+		{"nothing skipped", exitOK, nil},
+		{"bad flag", exitUsage, nil},
+		{"help", exitOK, nil},
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestExitCodes$")
+		cmd.Env = append(os.Environ(), exitCaseEnv+"="+tt.name)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		code := exitOK
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if code != tt.code {
+			t.Errorf("%s: exit code %d, want %d (stderr %q)", tt.name, code, tt.code, stderr.String())
+		}
+		if tt.report == nil {
+			continue
+		}
+		var r errorReport
+		if err := json.Unmarshal(stderr.Bytes(), &r); err != nil {
+			t.Errorf("%s: stderr %q isn't a report: %v", tt.name, stderr.String(), err)
+			continue
+		}
+		if r.Code != tt.report.Code || r.Kind != tt.report.Kind || r.Error != tt.report.Error || !slices.Equal(r.Blocks, tt.report.Blocks) {
+			t.Errorf("%s: report %+v, want %+v", tt.name, r, *tt.report)
+		}
+	}
+}
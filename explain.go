@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// runExplain prints how the selected chain's scanner handles one
+// transaction: the call it unwrapped, the selector gate, each decoder's
+// candidates and each validator's verdict on them, then the messages found.
+func runExplain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+	h := fs.Arg(0)
+	if fs.NArg() != 1 || !isHexHash(h) {
+		fatalf(exitUsage, "usage: explain [flags] <tx hash>")
+	}
+
+	chain := chainOpts.resolve()
+	client := chain.dial()
+	tx, _, err := client.TransactionByHash(context.Background(), common.HexToHash(h))
+	if err != nil {
+		fatalf(exitProvider, "Tx %s fetch error: %v", h, err)
+	}
+	from, _ := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	scanner := chainOpts.scanner()
+
+	fmt.Printf("Tx %s\n", tx.Hash().Hex())
+	if link := chain.txURL(tx.Hash().Hex()); link != "" {
+		fmt.Printf("Link: %s\n", link)
+	}
+	trace := scanner.Explain(txmsg.Call{From: from, To: tx.To(), Value: tx.Value(), Data: tx.Data()})
+	printTrace(trace, 0)
+
+	msgs := scanner.ScanTx(tx)
+	fmt.Printf("\nDecision: %d messages\n", len(msgs))
+	for _, msg := range msgs {
+		fmt.Printf("  %q (%s)\n", msg.Text, msg.Decoder)
+	}
+}
+
+// isHexHash reports whether s is a 0x-prefixed hex hash, such as a tx hash.
+func isHexHash(s string) bool {
+	if len(s) != 2+2*common.HashLength || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+// printTrace prints a trace and the traces nested in it, indented by depth.
+func printTrace(t *txmsg.Trace, depth int) {
+	indent := strings.Repeat("  ", depth)
+	to := "contract creation"
+	if t.Call.To != nil {
+		to = t.Call.To.Hex()
+	}
+	fmt.Printf("%sCall from %s to %s, %d bytes of calldata\n", indent, t.Call.From.Hex(), to, len(t.Call.Data))
+	switch {
+	case t.Unwrapper != "":
+		fmt.Printf("%s  Unwrapped by %s into %d calls\n", indent, t.Unwrapper, len(t.Nested))
+		for _, n := range t.Nested {
+			printTrace(n, depth+2)
+		}
+		return
+	case t.Skipped != "":
+		fmt.Printf("%s  Skipped: %s\n", indent, t.Skipped)
+		return
+	case t.Large:
+		fmt.Printf("%s  Large payload: using the large decoders and validators\n", indent)
+	}
+	if t.Claimed != "" {
+		fmt.Printf("%s  Claimed by %s: no other decoder runs\n", indent, t.Claimed)
+	}
+	for _, d := range t.Decoders {
+		if d.Prescanned {
+			fmt.Printf("%s  Decoder %s: prescan found no run of text long enough for a candidate, not decoded\n", indent, d.Decoder)
+			continue
+		}
+		fmt.Printf("%s  Decoder %s: %d candidates\n", indent, d.Decoder, len(d.Candidates))
+		for _, c := range d.Candidates {
+			switch {
+			case c.Duplicate:
+				fmt.Printf("%s    %q: duplicate of an accepted candidate\n", indent, c.Text)
+				continue
+			case c.Accepted:
+				fmt.Printf("%s    %q: accepted\n", indent, c.Text)
+			default:
+				fmt.Printf("%s    %q: rejected\n", indent, c.Text)
+			}
+			for _, check := range c.Checks {
+				verdict := "fail"
+				if check.Passed {
+					verdict = "pass"
+				}
+				fmt.Printf("%s      %s: %s", indent, check.Validator, verdict)
+				if check.Detail != "" {
+					fmt.Printf(" (%s)", check.Detail)
+				}
+				fmt.Println()
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestIsHexHash(t *testing.T) {
+	for s, want := range map[string]bool{
+		"0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060": true,
+		"0x5C504ED432CB51138BCF09AA5E8A410DD4A1E204EF84BFED1BE16DFBA1B22060": true,
+		"0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b2206z": false,
+		"0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b2206":  false,
+		"005c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060": false,
+		"": false,
+	} {
+		if got := isHexHash(s); got != want {
+			t.Errorf("isHexHash(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// graphNode is an address in the messaging network.
+type graphNode struct {
+	addr           common.Address
+	label          string
+	sent, received int // Messages
+}
+
+// graphEdge is the conversation from one address to another.
+type graphEdge struct {
+	from, to common.Address
+	messages int
+	txs      int
+}
+
+// messageGraph is the sender→recipient network of stored messages.
+type messageGraph struct {
+	nodes []*graphNode
+	edges []*graphEdge
+	msgs  []txmsg.Message
+}
+
+// runExport writes stored messages in formats other tools read. The only
+// export so far is graph.
+func runExport(args []string) {
+	if len(args) == 0 || args[0] != "graph" {
+		fatalf(exitUsage, "usage: export graph [-format graphml|dot|cypher] [-o file] [-from N] [-to M]")
+	}
+	fs := flag.NewFlagSet("export graph", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	format := fs.String("format", "graphml", "output format: graphml, dot or cypher")
+	outPath := fs.String("o", "", "output file (default: standard output)")
+	from := fs.Uint64("from", 0, "first block")
+	to := fs.Uint64("to", 0, "last block")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args[1:])
+
+	var write func(io.Writer, *messageGraph) error
+	switch *format {
+	case "graphml":
+		write = writeGraphML
+	case "dot":
+		write = writeDOT
+	case "cypher":
+		write = writeCypher
+	default:
+		fatalf(exitUsage, "Unknown format %q", *format)
+	}
+
+	cfg := chainOpts.loadConfig()
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	msgs, err := st.Query(context.Background(), store.Query{FromBlock: *from, ToBlock: *to})
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	g := buildGraph(msgs, cfg.label)
+
+	out := os.Stdout
+	if *outPath != "" {
+		if out, err = os.Create(*outPath); err != nil {
+			fatalf(exitFailure, "Export error: %v", err)
+		}
+	}
+	w := bufio.NewWriter(out)
+	if err := write(w, g); err != nil {
+		fatalf(exitFailure, "Export error: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		fatalf(exitFailure, "Export error: %v", err)
+	}
+	if *outPath != "" {
+		if err := out.Close(); err != nil {
+			fatalf(exitFailure, "Export error: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d addresses and %d conversations from %d messages to %s\n",
+			len(g.nodes), len(g.edges), len(msgs), *outPath)
+	}
+}
+
+// buildGraph returns the network of msgs, naming addresses with label.
+// Messages to contract creations have no recipient and only count towards
+// their sender.
+func buildGraph(msgs []txmsg.Message, label func(common.Address) string) *messageGraph {
+	nodes := make(map[common.Address]*graphNode)
+	node := func(addr common.Address) *graphNode {
+		n, ok := nodes[addr]
+		if !ok {
+			n = &graphNode{addr: addr, label: label(addr)}
+			nodes[addr] = n
+		}
+		return n
+	}
+	type edgeKey struct{ from, to common.Address }
+	edges := make(map[edgeKey]*graphEdge)
+	lastTx := make(map[edgeKey]common.Hash)
+
+	for _, msg := range msgs {
+		node(msg.From).sent++
+		if msg.To == nil {
+			continue
+		}
+		node(*msg.To).received++
+		k := edgeKey{msg.From, *msg.To}
+		e, ok := edges[k]
+		if !ok {
+			e = &graphEdge{from: msg.From, to: *msg.To}
+			edges[k] = e
+		}
+		e.messages++
+		// Messages are ordered by block and tx hash, so a tx's messages are adjacent.
+		if prev, ok := lastTx[k]; !ok || prev != msg.TxHash {
+			e.txs++
+			lastTx[k] = msg.TxHash
+		}
+	}
+
+	g := &messageGraph{msgs: msgs}
+	for _, n := range nodes {
+		g.nodes = append(g.nodes, n)
+	}
+	for _, e := range edges {
+		g.edges = append(g.edges, e)
+	}
+	// Sort for reproducible output.
+	slices.SortFunc(g.nodes, func(a, b *graphNode) int { return a.addr.Cmp(b.addr) })
+	slices.SortFunc(g.edges, func(a, b *graphEdge) int {
+		return cmp.Or(a.from.Cmp(b.from), a.to.Cmp(b.to))
+	})
+	return g
+}
+
+// writeGraphML writes g as GraphML, with message counts as node and edge
+// weights, for Gephi, networkx and similar tools.
+func writeGraphML(w io.Writer, g *messageGraph) error {
+	io.WriteString(w, xml.Header)
+	io.WriteString(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="label" for="node" attr.name="label" attr.type="string"/>
+  <key id="sent" for="node" attr.name="sent" attr.type="int"/>
+  <key id="received" for="node" attr.name="received" attr.type="int"/>
+  <key id="nweight" for="node" attr.name="weight" attr.type="int"/>
+  <key id="eweight" for="edge" attr.name="weight" attr.type="int"/>
+  <key id="txs" for="edge" attr.name="txs" attr.type="int"/>
+  <graph id="messages" edgedefault="directed">
+`)
+	for _, n := range g.nodes {
+		fmt.Fprintf(w, "    <node id=\"%s\">\n", n.addr.Hex())
+		if n.label != "" {
+			fmt.Fprintf(w, "      <data key=\"label\">%s</data>\n", xmlEscape(n.label))
+		}
+		fmt.Fprintf(w, "      <data key=\"sent\">%d</data>\n", n.sent)
+		fmt.Fprintf(w, "      <data key=\"received\">%d</data>\n", n.received)
+		fmt.Fprintf(w, "      <data key=\"nweight\">%d</data>\n", n.sent+n.received)
+		io.WriteString(w, "    </node>\n")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "    <edge source=\"%s\" target=\"%s\">\n", e.from.Hex(), e.to.Hex())
+		fmt.Fprintf(w, "      <data key=\"eweight\">%d</data>\n", e.messages)
+		fmt.Fprintf(w, "      <data key=\"txs\">%d</data>\n", e.txs)
+		io.WriteString(w, "    </edge>\n")
+	}
+	_, err := io.WriteString(w, "  </graph>\n</graphml>\n")
+	return err
+}
+
+// writeDOT writes g in Graphviz DOT.
+func writeDOT(w io.Writer, g *messageGraph) error {
+	io.WriteString(w, "digraph messages {\n")
+	for _, n := range g.nodes {
+		label := n.addr.Hex()
+		if n.label != "" {
+			label = n.label + "\n" + label
+		}
+		fmt.Fprintf(w, "  %q [label=%s, sent=%d, received=%d, weight=%d];\n",
+			n.addr.Hex(), strconv.Quote(label), n.sent, n.received, n.sent+n.received)
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "  %q -> %q [weight=%d, txs=%d];\n", e.from.Hex(), e.to.Hex(), e.messages, e.txs)
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+// writeCypher writes g as a Cypher script for Neo4j (cypher-shell -f file).
+// Statements MERGE, so loading overlapping exports is safe. The schema is:
+//
+//	(:Address {address, label})
+//	(:Address)-[:SENT]->(:Message {tx, block, time, text, decoder})-[:TO]->(:Address)
+//	(:Address)-[:MESSAGED {messages, txs}]->(:Address)
+//
+// Addresses are checksummed hex. Messages to contract creations have no TO.
+// MESSAGED totals are counted from the Message nodes, so they cover every
+// export loaded so far rather than only the last one.
+func writeCypher(w io.Writer, g *messageGraph) error {
+	io.WriteString(w, "CREATE CONSTRAINT address_key IF NOT EXISTS FOR (a:Address) REQUIRE a.address IS UNIQUE;\n")
+	io.WriteString(w, "CREATE INDEX message_tx IF NOT EXISTS FOR (m:Message) ON (m.tx);\n")
+	for _, n := range g.nodes {
+		fmt.Fprintf(w, "MERGE (a:Address {address: %s})", cypherString(n.addr.Hex()))
+		if n.label != "" {
+			fmt.Fprintf(w, " SET a.label = %s", cypherString(n.label))
+		}
+		io.WriteString(w, ";\n")
+	}
+	for _, msg := range g.msgs {
+		fmt.Fprintf(w, "MATCH (a:Address {address: %s}) MERGE (m:Message {tx: %s, text: %s})"+
+			" SET m.block = %d, m.time = %d, m.decoder = %s MERGE (a)-[:SENT]->(m)",
+			cypherString(msg.From.Hex()), cypherString(msg.TxHash.Hex()), cypherString(msg.Text),
+			msg.Block, msg.Time, cypherString(msg.Decoder))
+		if msg.To != nil {
+			fmt.Fprintf(w, " WITH m MATCH (b:Address {address: %s}) MERGE (m)-[:TO]->(b)", cypherString(msg.To.Hex()))
+		}
+		io.WriteString(w, ";\n")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "MATCH (a:Address {address: %s})-[:SENT]->(m:Message)-[:TO]->(b:Address {address: %s})"+
+			" WITH a, b, count(m) AS messages, count(DISTINCT m.tx) AS txs"+
+			" MERGE (a)-[r:MESSAGED]->(b) SET r.messages = messages, r.txs = txs;\n",
+			cypherString(e.from.Hex()), cypherString(e.to.Hex()))
+	}
+	return nil
+}
+
+// cypherString quotes s as a Cypher string literal.
+func cypherString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// xmlEscape escapes s for use as XML character data.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
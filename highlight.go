@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// Bounds on the length of a highlight, in runes.
+const (
+	minHighlight = 20
+	maxHighlight = 280
+)
+
+// runHighlight picks the message of the day from the store: the best scoring
+// message of that day that is within the length bounds, was never seen before
+// that day, and wasn't repeated that day or sent by a sender posting in bulk.
+func runHighlight(args []string) {
+	fs := flag.NewFlagSet("highlight", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	date := fs.String("date", "", "day to pick from, as YYYY-MM-DD (default: yesterday, UTC)")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	start, err := parseDay(*date, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		fatalf(exitUsage, "Invalid -date: %v", err)
+	}
+
+	chain := chainOpts.lookup()
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+
+	best, ok, n, err := highlight(context.Background(), st.Store, start)
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	if !ok {
+		fmt.Printf("No highlight for %s among %d messages\n", start.Format(time.DateOnly), n)
+		return
+	}
+	fmt.Printf("Message of the day for %s:\n", start.Format(time.DateOnly))
+	printMessages(chain, best.Block, best.Time, "", []txmsg.Message{best})
+}
+
+// highlight returns the message of the day starting at dayStart, if one is
+// eligible, and how many messages were posted that day.
+func highlight(ctx context.Context, st *store.Store, dayStart time.Time) (txmsg.Message, bool, int, error) {
+	start := uint64(dayStart.Unix())
+	msgs, err := st.Query(ctx, store.Query{FromTime: start, ToTime: uint64(dayStart.AddDate(0, 0, 1).Unix()) - 1})
+	if err != nil {
+		return txmsg.Message{}, false, 0, err
+	}
+	best, ok, err := pickHighlight(ctx, st, msgs, start)
+	return best, ok, len(msgs), err
+}
+
+// pickHighlight returns the best scoring eligible message of msgs, all from
+// the day starting at dayStart.
+func pickHighlight(ctx context.Context, st *store.Store, msgs []txmsg.Message, dayStart uint64) (txmsg.Message, bool, error) {
+	texts := make(map[string]int)
+	senders := make(map[string]int)
+	for _, msg := range msgs {
+		texts[msg.Text]++
+		senders[msg.From.Hex()]++
+	}
+
+	var best txmsg.Message
+	bestScore := 0.0
+	for _, msg := range msgs {
+		n := len([]rune(msg.Text))
+		// Repeated texts and bulk senders are spam waves, not messages.
+		if n < minHighlight || n > maxHighlight || texts[msg.Text] > 1 || senders[msg.From.Hex()] > 3 {
+			continue
+		}
+		score := highlightScore(msg.Text)
+		if score <= bestScore {
+			continue
+		}
+		first, _, err := st.FirstSeen(ctx, msg.Text)
+		if err != nil {
+			return txmsg.Message{}, false, err
+		}
+		if first < dayStart {
+			continue // seen on an earlier day
+		}
+		best, bestScore = msg, score
+	}
+	return best, bestScore > 0, nil
+}
+
+// highlightScore rates how much text reads like a deliberate message: the
+// number of words the default heuristics count as plausible (capped, so walls
+// of text don't win) weighted by the share of letters.
+func highlightScore(text string) float64 {
+	m := txmsg.DefaultHeuristics.Measure(text)
+	return float64(min(m.ValidWords, 30)) * m.LetterRatio
+}
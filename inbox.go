@@ -0,0 +1,201 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// inbox lists the stored messages sent to a set of addresses, oldest first,
+// across the databases of one or more chains. Messages it shows are marked
+// read in their store unless peek is set.
+type inbox struct {
+	boxes      []*mailbox
+	cfg        *Config
+	recipients []common.Address
+	peek       bool
+	shown      map[string]bool // Messages already listed, by tx hash and text
+}
+
+// mailbox is a chain's database read by an inbox.
+type mailbox struct {
+	chain *Chain
+	store *store.Buffered
+}
+
+// runInbox shows the messages sent to the given addresses, unread ones first
+// marked with *. With -follow it keeps checking the databases, which watchers
+// or scans fill, for new messages.
+func runInbox(args []string) {
+	fs := flag.NewFlagSet("inbox", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	addresses := fs.String("address", "", "comma-separated addresses to show incoming messages for (required)")
+	chains := fs.String("chains", "", "comma-separated chains to read, each from its own database, or all for every "+
+		"built-in and configured chain that has one (default: -chain)")
+	all := fs.Bool("all", false, "show read messages too")
+	peek := fs.Bool("peek", false, "leave the messages shown unread")
+	follow := fs.Duration("follow", 0, "keep checking for new messages at this interval, e.g. 10s")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	var recipients []common.Address
+	for _, s := range strings.Split(*addresses, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !common.IsHexAddress(s) {
+			fatalf(exitUsage, "Invalid address %q", s)
+		}
+		recipients = append(recipients, common.HexToAddress(s))
+	}
+	if len(recipients) == 0 {
+		fatalf(exitUsage, "inbox needs -address")
+	}
+	if *chains != "" && *dbPath != "" {
+		fatalf(exitUsage, "-db reads a single database; use -chain with it instead of -chains")
+	}
+
+	cfg := chainOpts.loadConfig()
+	in := &inbox{
+		cfg:        cfg,
+		recipients: recipients,
+		peek:       *peek,
+		shown:      make(map[string]bool),
+	}
+	if *chains == "" {
+		in.boxes = []*mailbox{{chain: chainOpts.lookup(), store: openStore(chainOpts.dbPath(*dbPath))}}
+	} else {
+		for _, c := range cfg.selectChains(*chains) {
+			in.boxes = append(in.boxes, &mailbox{chain: c, store: openStore(c.file(storeFile))})
+		}
+	}
+	defer func() {
+		for _, b := range in.boxes {
+			b.store.Close()
+		}
+	}()
+	ctx := context.Background()
+
+	n, err := in.show(ctx, *all)
+	if err != nil {
+		fatalf(exitFailure, "Inbox error: %v", err)
+	}
+	fmt.Printf("%d new messages\n", n)
+	if *follow <= 0 {
+		return
+	}
+	for {
+		time.Sleep(*follow)
+		if _, err := in.show(ctx, false); err != nil {
+			log.Printf("Inbox error: %v", err)
+		}
+	}
+}
+
+// entry is a message listed by an inbox, with the mailbox it came from.
+type entry struct {
+	box    *mailbox
+	msg    txmsg.Message
+	unread bool
+}
+
+// show prints the unread messages not shown yet, or with all every message,
+// of every mailbox in time order, and returns how many of them were unread.
+func (in *inbox) show(ctx context.Context, all bool) (int, error) {
+	var entries []entry
+	for _, b := range in.boxes {
+		found, err := in.fetch(ctx, b, all)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", b.chain.Name, err)
+		}
+		entries = append(entries, found...)
+	}
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return cmp.Compare(a.msg.Time, b.msg.Time)
+	})
+
+	fresh := make(map[*mailbox][]txmsg.Message)
+	n := 0
+	for _, e := range entries {
+		in.print(e)
+		if e.unread {
+			fresh[e.box] = append(fresh[e.box], e.msg)
+			n++
+		}
+	}
+	if !in.peek {
+		for b, msgs := range fresh {
+			if err := b.store.MarkRead(ctx, msgs); err != nil {
+				return 0, fmt.Errorf("%s: %w", b.chain.Name, err)
+			}
+		}
+	}
+	return n, nil
+}
+
+// fetch returns b's unread messages not shown yet, or with all every message
+// not shown yet, and marks them shown.
+func (in *inbox) fetch(ctx context.Context, b *mailbox, all bool) ([]entry, error) {
+	q := store.Query{Recipients: in.recipients, Unread: true}
+	unread, err := b.store.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	msgs := unread
+	if all {
+		q.Unread = false
+		if msgs, err = b.store.Query(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+	isNew := make(map[string]bool)
+	for _, msg := range unread {
+		isNew[messageKey(msg)] = true
+	}
+
+	var entries []entry
+	for _, msg := range msgs {
+		key := b.chain.Name + "\x00" + messageKey(msg)
+		if in.shown[key] {
+			continue
+		}
+		in.shown[key] = true
+		entries = append(entries, entry{box: b, msg: msg, unread: isNew[messageKey(msg)]})
+	}
+	return entries, nil
+}
+
+// print prints one inbox entry, naming its chain if the inbox reads several.
+func (in *inbox) print(e entry) {
+	mark := " "
+	if e.unread {
+		mark = "*"
+	}
+	fmt.Printf("%s %s  block %d", mark, formatBlockTime(e.msg.Time), e.msg.Block)
+	if len(in.boxes) > 1 {
+		fmt.Printf(" on %s", e.box.chain.Name)
+	}
+	fmt.Printf("\n  From %s%s", e.msg.From.Hex(), labelSuffix(in.cfg, e.msg.From))
+	if e.msg.To != nil {
+		fmt.Printf(" to %s%s", e.msg.To.Hex(), labelSuffix(in.cfg, *e.msg.To))
+	}
+	fmt.Printf("\n  %q\n", e.msg.Text)
+	if link := e.box.chain.txURL(e.msg.TxHash.Hex()); link != "" {
+		fmt.Printf("  Link: %s\n", link)
+	}
+	fmt.Println()
+}
+
+// messageKey identifies a message, as the store does.
+func messageKey(msg txmsg.Message) string {
+	return msg.TxHash.Hex() + "\x00" + msg.Text
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+)
+
+// watchLease is the name of the lease watchers sharing a store compete for.
+const watchLease = "watch"
+
+// leaseHolder returns a name for this process in the lease table.
+func leaseHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// checkLease takes or renews the leader lease. A watcher that can't reach the
+// store can't write either, so it gives up leadership until it can. A watcher
+// that loses the lease forgets its recent blocks, since the new leader writes
+// them from now on; if it becomes leader again, it catches up from the
+// checkpoint.
+func (w *watcher) checkLease(ctx context.Context) {
+	leader, err := w.store.AcquireLease(ctx, watchLease, w.holder, w.lease)
+	if err != nil {
+		log.Printf("Lease error: %v", err)
+	}
+	switch {
+	case leader && !w.leader:
+		log.Printf("Elected leader as %s", w.holder)
+		w.notify("STATUS=Leading on " + w.chain.Name)
+	case !leader && w.leader:
+		log.Printf("Lost leadership, standing by")
+		w.notify("STATUS=Standing by on " + w.chain.Name)
+		clear(w.blocks)
+	}
+	w.leader = leader
+}
+
+// catchUp scans the blocks between the store's checkpoint and head, which the
+// previous leader didn't get to, so that failing over leaves no gap. A
+// checkpoint more than reorgDepth blocks behind wasn't left by a recent leader
+// (e.g. it is from a range scan), so nothing is caught up.
+func (w *watcher) catchUp(ctx context.Context, client blockFetcher, head uint64) error {
+	checkpoint, ok, err := w.store.Checkpoint(ctx)
+	if err != nil || !ok || checkpoint+1 >= head {
+		return err
+	}
+	if head-checkpoint > reorgDepth {
+		log.Printf("Checkpoint %d is too far behind to catch up; backfill it with a scan", checkpoint)
+		return nil
+	}
+	log.Printf("Catching up blocks %d-%d", checkpoint+1, head-1)
+	for num := checkpoint + 1; num < head; num++ {
+		n := getBlockNumber(int64(num))
+		block, err := client.BlockByNumber(ctx, n)
+		putBlockNumber(n)
+		if err != nil {
+			return fmt.Errorf("catch up block %d: %w", num, err)
+		}
+		if parent, ok := w.blocks[num-1]; ok && parent.hash != block.ParentHash() {
+			return nil // a reorg; handleHead walks back to the fork from the head
+		}
+		w.emit(ctx, block)
+	}
+	return nil
+}
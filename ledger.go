@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// skippedBlock is an entry in the skipped-block ledger.
+type skippedBlock struct {
+	Block  int64
+	Reason string
+}
+
+// appendSkipped records a block that couldn't be scanned in the ledger at path.
+// Ephemeral runs keep no ledger.
+func appendSkipped(path string, blockNum int64, cause error) error {
+	if ephemeral {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reason := strings.ReplaceAll(cause.Error(), "\n", " ")
+	_, err = fmt.Fprintf(f, "%d\t%s\n", blockNum, reason)
+	return err
+}
+
+// readSkipped loads the ledger at path, one entry per block, lowest block first.
+// A block skipped more than once keeps its most recent reason. A missing file
+// yields an empty ledger.
+func readSkipped(path string) ([]skippedBlock, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	byBlock := make(map[int64]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		num, reason, _ := strings.Cut(line, "\t")
+		blockNum, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: bad block number %q", path, num)
+		}
+		byBlock[blockNum] = reason
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	blocks := make([]skippedBlock, 0, len(byBlock))
+	for blockNum, reason := range byBlock {
+		blocks = append(blocks, skippedBlock{Block: blockNum, Reason: reason})
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Block < blocks[j].Block })
+	return blocks, nil
+}
+
+// writeSkipped replaces the ledger at path with blocks.
+func writeSkipped(path string, blocks []skippedBlock) error {
+	var sb strings.Builder
+	for _, b := range blocks {
+		sb.WriteString(fmt.Sprintf("%d\t%s\n", b.Block, b.Reason))
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
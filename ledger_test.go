@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLedgerKeepsLatestReason(t *testing.T) {
+	path := filepath.Join(t.TempDir(), skippedFile)
+	for _, e := range []struct {
+		block int64
+		cause string
+	}{
+		{20, "timeout"},
+		{7, "not found"},
+		{20, "rate limited\nretry later"},
+	} {
+		if err := appendSkipped(path, e.block, errors.New(e.cause)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks, err := readSkipped(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []skippedBlock{{7, "not found"}, {20, "rate limited retry later"}}
+	if len(blocks) != len(want) {
+		t.Fatalf("readSkipped = %v, want %v", blocks, want)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, blocks[i], want[i])
+		}
+	}
+}
+
+func TestLedgerRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), skippedFile)
+	if blocks, err := readSkipped(path); err != nil || blocks != nil {
+		t.Fatalf("readSkipped of a missing ledger = %v, %v; want nothing", blocks, err)
+	}
+
+	want := []skippedBlock{{3, "header not found"}, {9, "connection reset"}}
+	if err := writeSkipped(path, want); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readSkipped(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0] != want[0] || blocks[1] != want[1] {
+		t.Errorf("readSkipped after writeSkipped = %v, want %v", blocks, want)
+	}
+
+	// Repairing every block leaves an empty ledger, not a missing one.
+	if err := writeSkipped(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, err := readSkipped(path); err != nil || len(blocks) != 0 {
+		t.Errorf("readSkipped of an emptied ledger = %v, %v", blocks, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary ledger left behind: %v", err)
+	}
+}
+
+func TestLedgerRejectsBadBlockNumber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), skippedFile)
+	if err := os.WriteFile(path, []byte("12\tok\nabc\tbroken\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSkipped(path); err == nil {
+		t.Error("readSkipped accepted a bad block number")
+	}
+}
+
+func TestEphemeralKeepsNoLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), skippedFile)
+	ephemeral = true
+	defer func() { ephemeral = false }()
+	if err := appendSkipped(path, 1, errors.New("timeout")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ephemeral run wrote a ledger: %v", err)
+	}
+}
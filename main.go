@@ -1,217 +1,233 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"math/big"
 	"os"
-	"regexp"
+	"slices"
 	"strings"
 	"time"
-	"unicode"
-	"unicode/utf8"
 
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/joho/godotenv"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
 )
 
 // Configuration
 const (
-	scanDepth     = 100 // Number of blocks to scan from the current block downward
-	minMsgLength  = 4   // Minimum message length to consider
-	minWordLength = 3   // Minimum word length in valid message
-	minWords      = 2   // Minimum words in valid message
-	letterRatio   = 0.6 // Minimum ratio of letters in valid message
-)
-
-var (
-	// Common Ethereum function signatures (first 4 bytes of keccak256 hash)
-	functionSignatures = map[string]string{
-		"a9059cbb": "ERC20 transfer",
-		"23b872dd": "ERC20 transferFrom",
-		"095ea7b3": "ERC20 approve",
-		"42842e0e": "ERC721 safeTransferFrom",
-		"b88d4fde": "ERC721 safeTransferFrom with data",
-		"a22cb465": "setApprovalForAll",
-		"6352211e": "ownerOf (ERC721)",
-		"70a08231": "balanceOf",
-		"06fdde03": "name()",
-		"95d89b41": "symbol()",
-	}
-)
-
-func main() {
-	// Load environment variables
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
+	scanDepth = 100 // Number of blocks to scan from the current block downward
+	taskSize  = 10  // Number of blocks per manifest task
 
-	infuraKey := os.Getenv("INFURA_KEY")
-	if infuraKey == "" {
-		log.Fatal("INFURA_KEY not found in .env file")
-	}
+	defaultWorkers = 4 // Concurrent block fetches
+	defaultRate    = 4 // RPC requests per second
+	maxRetries     = 3 // Retries of a failed block fetch, with exponential backoff
 
-	client, err := ethclient.Dial(fmt.Sprintf("wss://mainnet.infura.io/ws/v3/%s", infuraKey))
-	if err != nil {
-		log.Fatal("Connection error:", err)
-	}
-
-	header, err := client.HeaderByNumber(context.Background(), nil)
-	if err != nil {
-		log.Fatal("Block header error:", err)
-	}
+	defaultMaxSkew = time.Minute // How far ahead of the local clock a block timestamp may be
 
-	endBlock := header.Number.Int64()
-	startBlock := endBlock - scanDepth
+	// State files of mainnet; other chains have their own (see Chain.file).
+	manifestFile = "manifest.json"      // Record of scanned block-range tasks
+	skippedFile  = "skipped_blocks.txt" // Ledger of blocks that couldn't be scanned
+	corpusFile   = "corpus.json"        // Golden corpus of pinned detections
+	storeFile    = "txmsg.db"           // SQLite database of discovered messages
+	configFile   = "config.json"        // Optional chain definitions
 
-	// Compile a regex to match candidate messages.
-	msgPattern := regexp.MustCompile(fmt.Sprintf(`[\p{L}\p{N}\s]{%d,}`, minMsgLength))
-	msgPattern.Longest()
+	pendingSuffix = ".pending" // Suffix of the file buffering messages while the store is down
 
-	// Count down from the current block to the startBlock.
-	for blockNum := endBlock; blockNum >= startBlock; blockNum-- {
-		processBlock(client, blockNum, msgPattern)
-		time.Sleep(250 * time.Millisecond)
-	}
-}
-
-// processBlock fetches the block and groups valid transactions (with messages)
-// so that the block header is printed only once.
-func processBlock(client *ethclient.Client, blockNum int64, pattern *regexp.Regexp) {
-	block, err := client.BlockByNumber(context.Background(), big.NewInt(blockNum))
-	if err != nil {
-		log.Printf("Block %d fetch error: %v", blockNum, err)
-		return
-	}
+	reorgDepth    = 64           // Number of recent blocks watch mode keeps to detect reorgs
+	maxReconnect  = time.Minute  // Upper bound on the watch reconnect backoff
+	stallBlocks   = 10           // Block times without a new head before watch mode reconnects
+	timestampForm = time.RFC3339 // Format of block timestamps in output
+)
 
-	// Accumulate output for all transactions in this block.
-	var blockOutputs []string
-	for _, tx := range block.Transactions() {
-		validMessages := analyzeTransaction(tx, pattern)
-		if len(validMessages) > 0 {
-			var sb strings.Builder
-			sb.WriteString(fmt.Sprintf("Tx: %s\nPossible messages:\n", tx.Hash().Hex()))
-			for _, msg := range validMessages {
-				sb.WriteString(fmt.Sprintf("  - %q\n", msg))
-			}
-			blockOutputs = append(blockOutputs, sb.String())
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "repair":
+			runRepair(os.Args[2:])
+			return
+		case "sql":
+			runSQL(os.Args[2:])
+			return
+		case "corpus":
+			runCorpus(os.Args[2:])
+			return
+		case "check":
+			runCheck(os.Args[2:])
+			return
+		case "selectors":
+			runSelectors(os.Args[2:])
+			return
+		case "feedback":
+			runFeedback(os.Args[2:])
+			return
+		case "autotune":
+			runAutotune(os.Args[2:])
+			return
+		case "query":
+			runQuery(os.Args[2:])
+			return
+		case "inbox":
+			runInbox(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "explain":
+			runExplain(os.Args[2:])
+			return
+		case "coverage":
+			runCoverage(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "demo":
+			runDemo(os.Args[2:])
+			return
+		case "onthisday":
+			runOnThisDay(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "service":
+			runService(os.Args[2:])
+			return
+		case "stdin":
+			runStdin(os.Args[2:])
+			return
+		case "refs":
+			runRefs(os.Args[2:])
+			return
+		case "highlight":
+			runHighlight(os.Args[2:])
+			return
+		case "random":
+			runRandom(os.Args[2:])
+			return
+		case "devnet":
+			runDevnet(os.Args[2:])
+			return
 		}
 	}
 
-	// If any transaction in this block contained a valid message, print them.
-	if len(blockOutputs) > 0 {
-		fmt.Printf("\nBlock %d\n", blockNum)
-		for _, out := range blockOutputs {
-			fmt.Println(out)
-		}
-	}
+	runScan(os.Args[1:])
 }
 
-// analyzeTransaction checks a transaction’s data and returns valid messages, if any.
-func analyzeTransaction(tx *types.Transaction, pattern *regexp.Regexp) []string {
-	data := tx.Data()
-	// Skip transactions with no data or known contract call signatures.
-	if len(data) == 0 || isContractCall(data) {
-		return nil
-	}
-
-	utf8Data := decodeUTF8(data)
-	matches := pattern.FindAllString(utf8Data, -1)
-	if len(matches) == 0 {
-		return nil
-	}
+// ephemeral is set by -store memory: nothing is written to disk, so the
+// manifest, skipped-block ledger and pending messages are not kept either.
+var ephemeral bool
 
-	var validMessages []string
-	for _, msg := range matches {
-		if isValidMessage(msg) {
-			validMessages = append(validMessages, msg)
-		}
+// openMemoryStore opens an in-memory message database, exiting on failure.
+func openMemoryStore() *store.Buffered {
+	st, err := store.OpenMemory()
+	if err != nil {
+		fatalf(exitStore, "Store error: %v", err)
 	}
-	return validMessages
+	return store.NewBuffered(st, "")
 }
 
-// isContractCall checks if the first 4 bytes of data match a known function signature.
-func isContractCall(data []byte) bool {
-	if len(data) < 4 {
-		return false
+// openStore opens the message database, exiting on failure. Messages the
+// database rejects later on are buffered next to it and replayed on recovery.
+func openStore(path string) *store.Buffered {
+	st, err := store.Open(path)
+	if err != nil {
+		fatalf(exitStore, "Store error: %v", err)
 	}
-	sig := hex.EncodeToString(data[:4])
-	_, exists := functionSignatures[sig]
-	return exists
+	return store.NewBuffered(st, path+pendingSuffix)
 }
 
-// decodeUTF8 decodes a byte slice into a cleaned-up UTF-8 string.
-func decodeUTF8(data []byte) string {
-	var sb strings.Builder
-	for len(data) > 0 {
-		r, size := utf8.DecodeRune(data)
-		if r == utf8.RuneError {
-			data = data[1:]
-			continue
+// saveMessages saves msgs to st, and writes them to the -out directory if set.
+// Messages buffered because the store is unavailable are logged but not
+// treated as an error.
+func saveMessages(ctx context.Context, st *store.Buffered, msgs []txmsg.Message) error {
+	if output != nil {
+		if err := output.Write(msgs); err != nil {
+			log.Printf("Output error: %v", err)
 		}
-		if unicode.IsPrint(r) {
-			sb.WriteRune(r)
-		}
-		data = data[size:]
 	}
-	return strings.Join(strings.Fields(sb.String()), " ")
+	_, err := st.Save(ctx, msgs)
+	if errors.Is(err, store.ErrBuffered) {
+		log.Printf("Store error: %v", err)
+		return nil
+	}
+	return err
 }
 
-// isValidMessage applies our heuristics (letter ratio and valid words) to the message.
-func isValidMessage(s string) bool {
-	words := strings.Fields(s)
-	if len(words) < minWords {
-		return false
+// processBlock fetches the block, prints its messages and saves them to the
+// store. It returns the block hash.
+func processBlock(client blockFetcher, chain *Chain, st *store.Buffered, blockNum int64, scanner *txmsg.Scanner) (common.Hash, error) {
+	ctx := context.Background()
+	num := getBlockNumber(blockNum)
+	block, err := client.BlockByNumber(ctx, num)
+	putBlockNumber(num)
+	if err != nil {
+		return common.Hash{}, err
 	}
 
-	letterCount := 0
-	totalChars := 0
-	for _, r := range s {
-		if unicode.IsLetter(r) {
-			letterCount++
-		}
-		if !unicode.IsSpace(r) {
-			totalChars++
-		}
+	msgs := scanner.ScanBlock(ctx, block)
+	printMessages(chain, block.NumberU64(), block.Time(), "", msgs)
+	if err := saveMessages(ctx, st, msgs); err != nil {
+		return common.Hash{}, fmt.Errorf("store: %w", err)
 	}
-
-	return float64(letterCount)/float64(totalChars) >= letterRatio &&
-		hasValidWords(words)
+	return block.Hash(), nil
 }
 
-// hasValidWords requires that each word is at least minWordLength, contains letters,
-// and (with our extra heuristic) includes at least one vowel.
-func hasValidWords(words []string) bool {
-	validWords := 0
-	for _, word := range words {
-		if len(word) >= minWordLength && hasLetters(word) && hasVowel(word) {
-			validWords++
-		}
+// printMessages prints the messages found in a block, grouped so that the block
+// header is printed only once per block and the tx header once per transaction.
+// A non-empty note is appended to the block header. Values and explorer links
+// follow the chain's currency and explorer templates.
+func printMessages(chain *Chain, blockNum, blockTime uint64, note string, msgs []txmsg.Message) {
+	if len(msgs) == 0 {
+		return
 	}
-	return validWords >= minWords
-}
 
-// hasLetters checks if there is at least one letter in the string.
-func hasLetters(s string) bool {
-	for _, r := range s {
-		if unicode.IsLetter(r) {
-			return true
+	// Accumulate output for all transactions in this block.
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "\nBlock %d (%s)", blockNum, formatBlockTime(blockTime))
+	if note != "" {
+		fmt.Fprintf(&out, " %s", note)
+	}
+	out.WriteByte('\n')
+	if link := chain.blockURL(blockNum); link != "" {
+		fmt.Fprintf(&out, "Link: %s\n", link)
+	}
+	for i, msg := range msgs {
+		if i == 0 || msg.TxHash != msgs[i-1].TxHash {
+			if i > 0 {
+				out.WriteByte('\n')
+			}
+			fmt.Fprintf(&out, "Tx: %s\nFrom: %s", msg.TxHash.Hex(), msg.From.Hex())
+			if link := chain.addressURL(msg.From.Hex()); link != "" {
+				fmt.Fprintf(&out, " (%s)", link)
+			}
+			out.WriteByte('\n')
+			if msg.Value != nil && msg.Value.Sign() > 0 {
+				fmt.Fprintf(&out, "Value: %s\n", chain.formatValue(msg.Value))
+			}
+			if link := chain.txURL(msg.TxHash.Hex()); link != "" {
+				fmt.Fprintf(&out, "Link: %s\n", link)
+			}
+			out.WriteString("Possible messages:\n")
 		}
-	}
-	return false
-}
-
-// hasVowel returns true if the string contains at least one vowel (a, e, i, o, u).
-func hasVowel(s string) bool {
-	for _, r := range s {
-		switch unicode.ToLower(r) {
-		case 'a', 'e', 'i', 'o', 'u':
-			return true
+		fmt.Fprintf(&out, "  - %q\n", msg.Text)
+		if c := msg.Contacts; c != nil {
+			fmt.Fprintf(&out, "    Contacts: %s\n", strings.Join(slices.Concat(c.Emails, c.Handles, c.Phones), ", "))
+		}
+		if w := msg.FirstWriter; w != nil && w.TxHash != msg.TxHash {
+			fmt.Fprintf(&out, "    First written by %s in tx %s", w.From.Hex(), w.TxHash.Hex())
+			if w.ChainID != 0 && w.ChainID != msg.ChainID {
+				fmt.Fprintf(&out, " on chain %d", w.ChainID)
+			}
+			fmt.Fprintf(&out, " (%s), %d copies\n", formatBlockTime(w.Time), w.Copies)
 		}
 	}
-	return false
+	out.WriteByte('\n')
+	os.Stdout.Write(out.Bytes())
 }
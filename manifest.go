@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Task states recorded in the manifest.
+const (
+	taskPending  = "pending"  // Scan started but not finished
+	taskDone     = "done"     // Every block in the range was fetched and analyzed
+	taskFailed   = "failed"   // At least one block could not be fetched
+	taskVerified = "verified" // A verify pass re-fetched the range and the digest matched
+)
+
+// task is a contiguous block range tracked by the manifest. Tasks are aligned
+// to multiples of taskSize so that overlapping scans share the same entries.
+type task struct {
+	Start  int64  `json:"start"`
+	End    int64  `json:"end"`
+	State  string `json:"state"`
+	Digest string `json:"digest,omitempty"` // keccak256 over the block hashes, highest block first
+}
+
+// manifest is the on-disk record of every block-range task the scanner has run.
+type manifest struct {
+	path  string
+	tasks map[int64]*task
+}
+
+// loadManifest reads the manifest at path. A missing file yields an empty manifest.
+func loadManifest(path string) (*manifest, error) {
+	m := &manifest{path: path, tasks: make(map[int64]*task)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Tasks []*task `json:"tasks"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, t := range file.Tasks {
+		m.tasks[t.Start] = t
+	}
+	return m, nil
+}
+
+// save writes the manifest to a temporary file and renames it into place so
+// that an interrupted write never leaves a truncated manifest behind. Ephemeral
+// runs keep no manifest.
+func (m *manifest) save() error {
+	if ephemeral {
+		return nil
+	}
+	file := struct {
+		Tasks []*task `json:"tasks"`
+	}{Tasks: m.sorted()}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// sorted returns the tasks ordered by start block.
+func (m *manifest) sorted() []*task {
+	tasks := make([]*task, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Start < tasks[j].Start })
+	return tasks
+}
+
+// plan returns the tasks covering startBlock..endBlock, lowest first, creating
+// any that don't exist yet. The range is widened down to a task boundary, and
+// a new topmost task is capped at endBlock since later blocks don't exist yet.
+// A task is never shortened: one that already reaches past endBlock keeps its
+// end, so its later blocks stay in the manifest.
+func (m *manifest) plan(startBlock, endBlock int64) []*task {
+	var tasks []*task
+	for start := startBlock - startBlock%taskSize; start <= endBlock; start += taskSize {
+		end := min(start+taskSize-1, endBlock)
+		t, ok := m.tasks[start]
+		if !ok {
+			t = &task{Start: start, State: taskPending}
+			m.tasks[start] = t
+		}
+		t.End = max(t.End, end)
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// count returns how many tasks are in each state.
+func (m *manifest) count() map[string]int {
+	counts := make(map[string]int)
+	for _, t := range m.tasks {
+		counts[t.State]++
+	}
+	return counts
+}
+
+// rangeDigest hashes the block hashes of a task, in the order they were fetched.
+func rangeDigest(hashes []common.Hash) string {
+	var data []byte
+	for _, h := range hashes {
+		data = append(data, h.Bytes()...)
+	}
+	return crypto.Keccak256Hash(data).Hex()
+}
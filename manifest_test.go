@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanAlignsTasks(t *testing.T) {
+	m := &manifest{tasks: make(map[int64]*task)}
+	tasks := m.plan(25, 43)
+	want := [][2]int64{{20, 29}, {30, 39}, {40, 43}}
+	if len(tasks) != len(want) {
+		t.Fatalf("plan(25, 43) = %d tasks, want %d", len(tasks), len(want))
+	}
+	for i, tk := range tasks {
+		if tk.Start != want[i][0] || tk.End != want[i][1] || tk.State != taskPending {
+			t.Errorf("task %d = %d-%d %s, want %d-%d pending", i, tk.Start, tk.End, tk.State, want[i][0], want[i][1])
+		}
+	}
+
+	// A later head extends the topmost task rather than adding another.
+	tasks = m.plan(40, 47)
+	if len(tasks) != 1 || tasks[0].End != 47 || len(m.tasks) != 3 {
+		t.Errorf("plan(40, 47) = %d tasks ending at %d, manifest has %d; want 1 ending at 47, 3", len(tasks), tasks[0].End, len(m.tasks))
+	}
+}
+
+func TestPlanKeepsDoneTaskEnd(t *testing.T) {
+	m := &manifest{tasks: map[int64]*task{
+		20: {Start: 20, End: 29, State: taskDone, Digest: "0x01"},
+		30: {Start: 30, End: 39, State: taskVerified, Digest: "0x02"},
+	}}
+	tasks := m.plan(20, 34)
+	if len(tasks) != 2 {
+		t.Fatalf("plan(20, 34) = %d tasks, want 2", len(tasks))
+	}
+	if tk := m.tasks[30]; tk.End != 39 || tk.State != taskVerified || tk.Digest != "0x02" {
+		t.Errorf("task 30 = %d-%d %s %s, want 30-39 verified 0x02", tk.Start, tk.End, tk.State, tk.Digest)
+	}
+	if tk := m.tasks[20]; tk.End != 29 || tk.State != taskDone {
+		t.Errorf("task 20 = %d-%d %s, want 20-29 done", tk.Start, tk.End, tk.State)
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("loadManifest of a missing file: %v", err)
+	}
+	m.plan(0, 15)
+	m.tasks[0].State, m.tasks[0].Digest = taskDone, "0xabc"
+	m.tasks[10].State = taskFailed
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := loaded.count(); counts[taskDone] != 1 || counts[taskFailed] != 1 || len(loaded.tasks) != 2 {
+		t.Errorf("loaded manifest counts %v, want 1 done and 1 failed", counts)
+	}
+	if tk := loaded.tasks[0]; tk.End != 9 || tk.Digest != "0xabc" {
+		t.Errorf("loaded task 0 = %+v", *tk)
+	}
+	if tk := loaded.tasks[10]; tk.End != 15 {
+		t.Errorf("loaded task 10 = %+v", *tk)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// firstChainYear is the year of the Ethereum genesis block; no chain the
+// scanner knows about has messages from before it.
+const firstChainYear = 2015
+
+// runOnThisDay prints the stored messages posted on the same calendar day
+// (UTC) in earlier years: exactly -years ago, or every earlier year.
+func runOnThisDay(args []string) {
+	fs := flag.NewFlagSet("onthisday", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	years := fs.Int("years", 0, "only look exactly this many years back (default: every earlier year)")
+	date := fs.String("date", "", "day to look back from, as YYYY-MM-DD (default: today, UTC)")
+	limit := fs.Int("limit", 20, "maximum number of messages per year (0 for no limit)")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	day, err := parseDay(*date, time.Now())
+	if err != nil {
+		fatalf(exitUsage, "Invalid -date: %v", err)
+	}
+
+	chain := chainOpts.lookup()
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+
+	found, err := onThisDay(context.Background(), st.Store, day, *years, *limit)
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	total := 0
+	for _, y := range found {
+		fmt.Printf("\n=== %d year(s) ago: %s ===\n", y.Years, y.Date)
+		printByBlock(chain, y.Messages)
+		total += len(y.Messages)
+	}
+	fmt.Printf("\n%d messages on this day\n", total)
+}
+
+// yearAgo is the messages posted on a day some years back.
+type yearAgo struct {
+	Years    int             `json:"years"`
+	Date     string          `json:"date"` // YYYY-MM-DD
+	Messages []txmsg.Message `json:"messages"`
+}
+
+// onThisDay returns up to limit messages (0 for no limit) posted on the
+// calendar day of day exactly years ago, or in every earlier year if years
+// isn't positive, most recent year first. Years without messages are left out.
+func onThisDay(ctx context.Context, st *store.Store, day time.Time, years, limit int) ([]yearAgo, error) {
+	lookback := []int{years}
+	if years <= 0 {
+		lookback = nil
+		for n := 1; day.Year()-n >= firstChainYear; n++ {
+			lookback = append(lookback, n)
+		}
+	}
+
+	var found []yearAgo
+	for _, n := range lookback {
+		// AddDate normalises Feb 29 to Mar 1 in non-leap years.
+		start := day.AddDate(-n, 0, 0)
+		end := start.AddDate(0, 0, 1)
+		msgs, err := st.Query(ctx, store.Query{
+			FromTime: uint64(start.Unix()),
+			ToTime:   uint64(end.Unix()) - 1,
+			Limit:    limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) > 0 {
+			found = append(found, yearAgo{Years: n, Date: start.Format(time.DateOnly), Messages: msgs})
+		}
+	}
+	return found, nil
+}
+
+// parseDay returns the start (UTC) of the day s, given as YYYY-MM-DD, or of
+// the day of def if s is empty.
+func parseDay(s string, def time.Time) (time.Time, error) {
+	day := def.UTC()
+	if s != "" {
+		var err error
+		if day, err = time.Parse(time.DateOnly, s); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC), nil
+}
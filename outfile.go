@@ -0,0 +1,240 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// outIndexFile is the sidecar in an output directory listing its completed
+// files, one JSON outIndexEntry per line.
+const outIndexFile = "index.jsonl"
+
+// outIndexEntry describes a completed output file.
+type outIndexEntry struct {
+	File       string `json:"file"`
+	Messages   int    `json:"messages"`
+	FirstBlock uint64 `json:"firstBlock"`
+	LastBlock  uint64 `json:"lastBlock"`
+	FirstTime  uint64 `json:"firstTime"` // Block timestamps, in Unix seconds
+	LastTime   uint64 `json:"lastTime"`
+}
+
+// output is the directory messages are also written to, set by -out.
+var output *rotatingWriter
+
+// rotatingWriter writes messages as NDJSON to files in a directory. A file is
+// completed once it reaches maxSize bytes or has been open for maxAge: it is
+// compressed with gzip and listed in the index sidecar.
+type rotatingWriter struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	f      *os.File
+	enc    *json.Encoder
+	size   int64
+	opened time.Time
+	entry  outIndexEntry // The current file
+}
+
+// newRotatingWriter returns a writer to dir, creating it if needed, after
+// completing any file a previous run left open. Files are opened on the first
+// message.
+func newRotatingWriter(dir string, maxSize int64, maxAge time.Duration) (*rotatingWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	w := &rotatingWriter{dir: dir, maxSize: maxSize, maxAge: maxAge}
+	if err := w.completeLeftovers(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// completeLeftovers completes the uncompressed files in the directory, which
+// a previous run left open because it was killed or exited on a fatal error.
+// A message cut short by the exit is dropped; it is still in the store.
+func (w *rotatingWriter) completeLeftovers() error {
+	paths, err := filepath.Glob(filepath.Join(w.dir, "messages-*.ndjson"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		entry, err := readOutFile(path)
+		if err != nil {
+			return fmt.Errorf("recover %s: %w", path, err)
+		}
+		if entry.Messages == 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.index(path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readOutFile returns the index entry of the output file at path, truncating
+// the file after its last complete message.
+func readOutFile(path string) (outIndexEntry, error) {
+	entry := outIndexEntry{File: filepath.Base(path)}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return entry, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	var end int64
+	for {
+		var msg txmsg.Message
+		if err := dec.Decode(&msg); err != nil {
+			break
+		}
+		end = dec.InputOffset()
+		if entry.Messages == 0 {
+			entry.FirstBlock, entry.FirstTime = msg.Block, msg.Time
+		}
+		entry.LastBlock, entry.LastTime = msg.Block, msg.Time
+		entry.Messages++
+	}
+	if end > 0 {
+		end++ // keep the newline ending the last message
+	}
+	if info, err := f.Stat(); err != nil || info.Size() <= end {
+		return entry, err
+	}
+	return entry, f.Truncate(end)
+}
+
+// Write appends msgs to the current file, first completing it if it is due.
+// It is called for every scanned block, so that age-based rotation happens
+// even while no messages arrive.
+func (w *rotatingWriter) Write(msgs []txmsg.Message) error {
+	if w.f != nil && (w.size >= w.maxSize || time.Since(w.opened) >= w.maxAge) {
+		if err := w.complete(); err != nil {
+			return err
+		}
+	}
+	for _, msg := range msgs {
+		if w.f == nil {
+			if err := w.open(); err != nil {
+				return err
+			}
+		}
+		if err := w.enc.Encode(msg); err != nil {
+			return err
+		}
+		if w.entry.Messages == 0 {
+			w.entry.FirstBlock, w.entry.FirstTime = msg.Block, msg.Time
+		}
+		w.entry.LastBlock, w.entry.LastTime = msg.Block, msg.Time
+		w.entry.Messages++
+	}
+	return nil
+}
+
+// Close completes the current file, if any.
+func (w *rotatingWriter) Close() error {
+	if w.f == nil {
+		return nil
+	}
+	return w.complete()
+}
+
+// open starts a new file named after the current time.
+func (w *rotatingWriter) open() error {
+	now := time.Now().UTC()
+	base := "messages-" + now.Format("20060102T150405Z")
+	name := base + ".ndjson"
+	for i := 2; fileExists(filepath.Join(w.dir, name)) || fileExists(filepath.Join(w.dir, name+".gz")); i++ {
+		name = fmt.Sprintf("%s-%d.ndjson", base, i)
+	}
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w.f, w.size, w.opened = f, 0, now
+	w.enc = json.NewEncoder(countingWriter{f, &w.size})
+	w.entry = outIndexEntry{File: name}
+	return nil
+}
+
+// complete closes the current file, compresses it and lists it in the index.
+func (w *rotatingWriter) complete() error {
+	path := w.f.Name()
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+	return w.index(path, w.entry)
+}
+
+// index compresses the file at path and lists it in the index as entry.
+func (w *rotatingWriter) index(path string, entry outIndexEntry) error {
+	if err := gzipFile(path); err != nil {
+		return fmt.Errorf("compress %s: %w", path, err)
+	}
+	entry.File += ".gz"
+
+	index, err := os.OpenFile(filepath.Join(w.dir, outIndexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(index).Encode(entry); err != nil {
+		index.Close()
+		return err
+	}
+	return index.Close()
+}
+
+// gzipFile replaces the file at path with path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	err = errors.Join(err, zw.Close(), out.Close())
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// countingWriter adds the number of bytes written to *n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+// Write implements io.Writer.
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// fileExists reports whether a file exists at path.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
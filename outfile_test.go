@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// readIndex returns the entries of the index in dir.
+func readIndex(t *testing.T, dir string) []outIndexEntry {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, outIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []outIndexEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e outIndexEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// countLines returns the number of lines in the gzipped file at path.
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for sc := bufio.NewScanner(zr); sc.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestRotatingWriterCompletesLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newRotatingWriter(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []txmsg.Message{{Text: "first message", Block: 10, Time: 100}, {Text: "second message", Block: 12, Time: 124}}
+	if err := w.Write(msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Exit without Close, cutting a third message short, as a killed run would.
+	path := w.f.Name()
+	w.f.WriteString(`{"text":"third mes`)
+	w.f.Close()
+
+	if _, err := newRotatingWriter(dir, 1<<20, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("leftover %s still uncompressed: %v", path, err)
+	}
+	entries := readIndex(t, dir)
+	if len(entries) != 1 {
+		t.Fatalf("index has %d entries, want 1", len(entries))
+	}
+	want := outIndexEntry{File: filepath.Base(path) + ".gz", Messages: 2, FirstBlock: 10, LastBlock: 12, FirstTime: 100, LastTime: 124}
+	if entries[0] != want {
+		t.Errorf("index entry = %+v, want %+v", entries[0], want)
+	}
+	if n := countLines(t, filepath.Join(dir, want.File)); n != 2 {
+		t.Errorf("completed file has %d lines, want 2", n)
+	}
+}
+
+func TestRotatingWriterRemovesEmptyLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "messages-20240101T000000Z.ndjson")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newRotatingWriter(dir, 1<<20, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*")); len(matches) != 0 {
+		t.Errorf("directory holds %v, want nothing", matches)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"math/big"
+	"sync"
+)
+
+// blockNumberPool holds the big.Ints passed to the RPC calls that fetch blocks
+// by number, one per block on the scan hot path.
+var blockNumberPool = sync.Pool{New: func() any { return new(big.Int) }}
+
+// getBlockNumber returns a pooled big.Int set to blockNum. Release it with
+// putBlockNumber once the RPC call that needed it has returned; the client
+// encodes the number into the request and doesn't keep it.
+func getBlockNumber(blockNum int64) *big.Int {
+	return blockNumberPool.Get().(*big.Int).SetInt64(blockNum)
+}
+
+// putBlockNumber returns n to the pool.
+func putBlockNumber(n *big.Int) {
+	blockNumberPool.Put(n)
+}
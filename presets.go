@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// preset is a named mainnet block range covering a notable period, with the
+// keywords that messages from it tend to mention.
+type preset struct {
+	Description string
+	Start, End  int64
+	Keywords    []string
+}
+
+// presets are the ranges selectable with -preset.
+var presets = map[string]preset{
+	"dao-hack": {
+		Description: "The DAO drain and the weeks of debate before the hard fork (June-July 2016)",
+		Start:       1718497,
+		End:         1920000,
+		Keywords:    []string{"dao", "hack", "hacked", "hacker", "fork", "refund", "attacker", "slock"},
+	},
+	"merge-week": {
+		Description: "The days around the switch to proof of stake (September 2022)",
+		Start:       15517000,
+		End:         15566000,
+		Keywords:    []string{"merge", "pos", "pow", "stake", "panda", "farewell", "miner"},
+	},
+	"ftx-collapse": {
+		Description: "FTX's collapse and bankruptcy filing (November 2022)",
+		Start:       15909000,
+		End:         15952000,
+		Keywords:    []string{"ftx", "sbf", "alameda", "bankrupt", "bankruptcy", "withdraw", "withdrawal", "exploit", "hack"},
+	},
+}
+
+// presetNames returns the preset names, sorted.
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupPreset returns the preset called name, exiting if there is none or it
+// doesn't apply to chain.
+func lookupPreset(name string, chain *Chain) preset {
+	p, ok := presets[name]
+	if !ok {
+		fatalf(exitUsage, "Unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+	}
+	if chain.ChainID != 1 {
+		fatalf(exitUsage, "Preset %q covers mainnet blocks; it can't be used with chain %q", name, chain.Name)
+	}
+	return p
+}
+
+// filterKeywords returns the messages whose text mentions any of keywords as
+// whole words, ignoring case, so "pos" matches "PoS!" but not "post". A keyword
+// of several words matches them in sequence. No keywords keeps every message.
+func filterKeywords(msgs []txmsg.Message, keywords []string) []txmsg.Message {
+	if len(keywords) == 0 {
+		return msgs
+	}
+	var kept []txmsg.Message
+	for _, msg := range msgs {
+		words := splitWords(msg.Text)
+		if slices.ContainsFunc(keywords, func(k string) bool { return containsWords(words, splitWords(k)) }) {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// splitWords returns the lowercase runs of letters and digits in s.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsWords reports whether seq appears, in order and adjacent, in words.
+func containsWords(words, seq []string) bool {
+	if len(seq) == 0 {
+		return false
+	}
+	for i := 0; i+len(seq) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(seq)], seq) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+func TestFilterKeywords(t *testing.T) {
+	for _, tt := range []struct {
+		text     string
+		keywords []string
+		want     bool
+	}{
+		{"Farewell PoW, hello PoS!", []string{"pos"}, true},
+		{"see my post about the merge", []string{"pos"}, false},
+		{"the power of a miner", []string{"pow"}, false},
+		{"proof-of-work is dead, long live pow", []string{"pow"}, true},
+		{"hiding in the shadow", []string{"dao"}, false},
+		{"The DAO was drained", []string{"dao"}, true},
+		{"a hard fork is coming", []string{"hard fork"}, true},
+		{"a hard spoon and a fork", []string{"hard fork"}, false},
+		{"FTX halted withdrawals", []string{"withdraw", "ftx"}, true},
+		{"nothing to see", []string{"pos", "pow", "dao"}, false},
+		{"anything at all", nil, true},
+	} {
+		got := len(filterKeywords([]txmsg.Message{{Text: tt.text}}, tt.keywords)) == 1
+		if got != tt.want {
+			t.Errorf("filterKeywords(%q, %q) kept = %v, want %v", tt.text, tt.keywords, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/url"
+	"runtime/debug"
+)
+
+// buildVersion returns the version of this binary: its module version when
+// installed with go install, or the VCS revision it was built from.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// providerHost returns the host of the RPC endpoint rpc, which names the
+// provider without the API key many of them put in the path.
+func providerHost(rpc string) string {
+	u, err := url.Parse(rpc)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
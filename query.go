@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// runQuery searches the message database and prints the results grouped by block.
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	keyword := fs.String("keyword", "", "only messages containing this text (case-insensitive)")
+	address := fs.String("address", "", "only messages sent from or to this address")
+	from := fs.Uint64("from", 0, "first block")
+	to := fs.Uint64("to", 0, "last block")
+	limit := fs.Int("limit", 100, "maximum number of messages (0 for no limit)")
+	showContext := fs.Bool("context", false, "show the decoded text around each message, with the message in «»")
+	asJSON := fs.Bool("json", false, "print one JSON object per message, with its contacts, entities and first writer")
+	chains := fs.String("chains", "", "comma-separated chains whose databases are also searched for first writers, or all "+
+		"for every built-in and configured chain that has one")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	q := store.Query{Keyword: *keyword, FromBlock: *from, ToBlock: *to, Limit: *limit}
+	if *address != "" {
+		if !common.IsHexAddress(*address) {
+			fatalf(exitUsage, "Invalid address %q", *address)
+		}
+		addr := common.HexToAddress(*address)
+		q.Address = &addr
+	}
+
+	chain := chainOpts.lookup()
+	path := chainOpts.dbPath(*dbPath)
+	st := openStore(path)
+	defer st.Close()
+	var others []*store.Store
+	if *chains != "" {
+		for _, c := range chainOpts.loadConfig().selectChains(*chains) {
+			otherPath := c.file(storeFile)
+			if otherPath == path {
+				continue
+			}
+			if _, err := os.Stat(otherPath); err != nil {
+				fatalf(exitUsage, "Chain %s has no database: %v", c.Name, err)
+			}
+			other, err := store.OpenReadOnly(otherPath)
+			if err != nil {
+				fatalf(exitStore, "Store error: %v", err)
+			}
+			defer other.Close()
+			others = append(others, other)
+		}
+	}
+	msgs, err := st.Query(context.Background(), q)
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	if err := st.Attribute(context.Background(), msgs, others...); err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, msg := range msgs {
+			if err := enc.Encode(msg); err != nil {
+				fatalf(exitFailure, "Output error: %v", err)
+			}
+		}
+		return
+	}
+
+	if *showContext {
+		for i := range msgs {
+			msgs[i].Text = withContext(msgs[i])
+		}
+	}
+	printByBlock(chain, msgs)
+	fmt.Printf("\n%d messages\n", len(msgs))
+}
+
+// printByBlock prints msgs, which are ordered by block, one group per block.
+func printByBlock(chain *Chain, msgs []txmsg.Message) {
+	for start := 0; start < len(msgs); {
+		end := start + 1
+		for end < len(msgs) && msgs[end].Block == msgs[start].Block {
+			end++
+		}
+		printMessages(chain, msgs[start].Block, msgs[start].Time, "", msgs[start:end])
+		start = end
+	}
+}
+
+// withContext returns the message text between the decoded text around it,
+// which shows whether the detection was cut short.
+func withContext(msg txmsg.Message) string {
+	return msg.Before + "«" + msg.Text + "»" + msg.After
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// runRandom scans randomly chosen historical blocks, printing and storing their
+// messages, and ends with the same survey as -sample. The seed is printed so a
+// run can be repeated.
+func runRandom(args []string) {
+	fs := flag.NewFlagSet("random", flag.ExitOnError)
+	count := fs.Int("count", 50, "number of blocks to scan")
+	seed := fs.Uint64("seed", 0, "random seed (default: derived from the clock)")
+	dbPath := fs.String("db", "", dbUsage)
+	chainOpts := addChainFlags(fs, "mainnet")
+	workers := fs.Int("workers", defaultWorkers, "number of concurrent block fetches")
+	rate := fs.Float64("rate", defaultRate, "maximum RPC requests per second")
+	parseFlags(fs, args)
+
+	if *count < 1 || *workers < 1 || !(*rate > 0) {
+		fatalf(exitUsage, "-count, -workers and -rate must be positive")
+	}
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+
+	// Registered first so that it exits only after the store is closed.
+	var skipped []int64
+	defer func() { exitIfSkipped(skipped) }()
+
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	chain := chainOpts.resolve()
+	client := chain.dial()
+	ctx := context.Background()
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		fatalf(exitProvider, "Block header error: %v", err)
+	}
+	head := header.Number.Int64()
+	nums := randomBlocks(rand.New(rand.NewPCG(*seed, 0)), head, *count)
+	fmt.Printf("Scanning %d random blocks up to %d (seed %d)\n", len(nums), head, *seed)
+
+	limiter := newRateLimiter(ctx, *rate, *workers)
+	skipped = runSample(ctx, client, chain, chainOpts.scanner(), st, 0, head, slices.Values(nums), *workers, limiter, nil)
+}
+
+// randomBlocks returns count distinct block numbers from 0 to head, or all of
+// them if there are fewer, in ascending order.
+func randomBlocks(r *rand.Rand, head int64, count int) []int64 {
+	if int64(count) > head+1 {
+		count = int(head + 1)
+	}
+	seen := make(map[int64]bool, count)
+	nums := make([]int64, 0, count)
+	for len(nums) < count {
+		n := r.Int64N(head + 1)
+		if !seen[n] {
+			seen[n] = true
+			nums = append(nums, n)
+		}
+	}
+	slices.Sort(nums)
+	return nums
+}
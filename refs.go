@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// runRefs prints the citations around a transaction or address: the tx hashes
+// and addresses quoted in its messages, resolved against the store and the
+// configured labels, and the stored messages that quote it in turn.
+func runRefs(args []string) {
+	fs := flag.NewFlagSet("refs", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	chainOpts := addChainFlags(fs, "mainnet")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s refs [flags] <tx hash | address>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return
+	}
+
+	subject := fs.Arg(0)
+	var q store.Query
+	switch {
+	case len(subject) == 66 && strings.HasPrefix(subject, "0x"):
+		hash := common.HexToHash(subject)
+		q.TxHash = &hash
+		subject = hash.Hex()
+		fmt.Printf("Tx %s\n", subject)
+	case common.IsHexAddress(subject):
+		addr := common.HexToAddress(subject)
+		q.Address = &addr
+		subject = addr.Hex()
+		fmt.Printf("Address %s%s\n", subject, labelSuffix(chainOpts.loadConfig(), addr))
+	default:
+		fatalf(exitUsage, "Invalid tx hash or address %q", subject)
+	}
+
+	chain := chainOpts.lookup()
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	ctx := context.Background()
+
+	msgs, err := st.Query(ctx, q)
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	fmt.Println("\nCites:")
+	cited := 0
+	for _, msg := range msgs {
+		for _, e := range msg.Entities {
+			if e.Type != txmsg.EntityTxHash && e.Type != txmsg.EntityETHAddress {
+				continue
+			}
+			ref, err := describeRef(ctx, st, chainOpts.loadConfig(), chain, e)
+			if err != nil {
+				fatalf(exitFailure, "Query error: %v", err)
+			}
+			fmt.Printf("  - %s\n", ref)
+			cited++
+		}
+	}
+	if cited == 0 {
+		fmt.Println("  nothing")
+	}
+
+	// Quoted hashes and addresses are found by text: LIKE ignores the case of
+	// checksummed addresses.
+	citing, err := st.Query(ctx, store.Query{Keyword: subject})
+	if err != nil {
+		fatalf(exitFailure, "Query error: %v", err)
+	}
+	fmt.Printf("\nCited by %d messages:\n", len(citing))
+	printByBlock(chain, citing)
+}
+
+// describeRef describes a quoted tx hash or address: how many stored messages
+// it has, its explorer link and, for an address, its label.
+func describeRef(ctx context.Context, st *store.Buffered, cfg *Config, chain *Chain, e txmsg.Entity) (string, error) {
+	var q store.Query
+	var desc, link string
+	if e.Type == txmsg.EntityTxHash {
+		hash := common.HexToHash(e.Value)
+		q.TxHash = &hash
+		desc, link = "tx "+hash.Hex(), chain.txURL(hash.Hex())
+	} else {
+		addr := common.HexToAddress(e.Value)
+		q.Address = &addr
+		desc, link = "address "+addr.Hex()+labelSuffix(cfg, addr), chain.addressURL(addr.Hex())
+	}
+	msgs, err := st.Query(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	desc = fmt.Sprintf("%s: %d stored messages", desc, len(msgs))
+	if link != "" {
+		desc += " (" + link + ")"
+	}
+	return desc, nil
+}
+
+// labelSuffix returns " (label)" for a labelled address, or "".
+func labelSuffix(cfg *Config, addr common.Address) string {
+	if label := cfg.label(addr); label != "" {
+		return " (" + label + ")"
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// runRepair retries every block in the skipped-block ledger. Blocks that scan
+// successfully are removed from the ledger; the rest stay with their new error.
+// Failed tasks whose blocks have all been repaired get a fresh digest and are
+// marked done again. Failed tasks without ledger entries, which verify found
+// no longer matching the chain, are rescanned in full first: their stored
+// messages are replaced with those of the blocks now on chain.
+func runRepair(args []string) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	chainOpts := addChainFlags(fs, "mainnet")
+	dbPath := fs.String("db", "", dbUsage)
+	rate := fs.Float64("rate", defaultRate, "maximum RPC requests per second")
+	parseFlags(fs, args)
+
+	if !(*rate > 0) {
+		fatalf(exitUsage, "-rate must be positive")
+	}
+
+	ledger := chainOpts.lookup().file(skippedFile)
+	blocks, err := readSkipped(ledger)
+	if err != nil {
+		fatalf(exitFailure, "Ledger error: %v", err)
+	}
+	m, err := loadManifest(chainOpts.lookup().file(manifestFile))
+	if err != nil {
+		fatalf(exitFailure, "Manifest error: %v", err)
+	}
+	var failed []*task
+	for _, t := range m.sorted() {
+		if t.State == taskFailed {
+			failed = append(failed, t)
+		}
+	}
+	if len(blocks) == 0 && len(failed) == 0 {
+		fmt.Println("No skipped blocks or failed tasks to repair")
+		return
+	}
+
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	chain := chainOpts.resolve()
+	client := chain.dial()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	limiter := newRateLimiter(ctx, *rate, 1)
+
+	remaining := repair(ctx, client, limiter, chain, st, chainOpts.scanner(), blocks, failed)
+	if err := writeSkipped(ledger, remaining); err != nil {
+		fatalf(exitFailure, "Ledger save error: %v", err)
+	}
+	if err := m.save(); err != nil {
+		fatalf(exitFailure, "Manifest save error: %v", err)
+	}
+}
+
+// repairClient is the part of ethclient.Client repair needs.
+type repairClient interface {
+	blockFetcher
+	headerFetcher
+}
+
+// repair retries the skipped blocks and then settles the failed tasks, marking
+// done the ones it repairs. It returns the blocks that still fail, with their
+// new error.
+func repair(ctx context.Context, client repairClient, limiter *rateLimiter, chain *Chain, st *store.Buffered,
+	scanner *txmsg.Scanner, blocks []skippedBlock, failed []*task) []skippedBlock {
+	var remaining []skippedBlock
+	for _, b := range blocks {
+		limiter.wait(ctx) // Fails only once ctx is done, after repair returns
+		if _, err := processBlock(client, chain, st, b.Block, scanner); err != nil {
+			log.Printf("Block %d scan error: %v", b.Block, err)
+			b.Reason = err.Error()
+			remaining = append(remaining, b)
+		} else {
+			addCoverage(ctx, st, scanner, b.Block, b.Block)
+		}
+	}
+	if len(blocks) > 0 {
+		fmt.Printf("Repaired %d of %d skipped blocks\n", len(blocks)-len(remaining), len(blocks))
+	}
+
+	rescanned := 0
+	for _, t := range failed {
+		if hasSkipped(remaining, t) {
+			continue
+		}
+		var digest string
+		var err error
+		if hasSkipped(blocks, t) {
+			// Only the ledger blocks were missing, and they are now stored.
+			digest, err = fetchDigest(ctx, client, limiter, t)
+			if err != nil {
+				log.Printf("Task %d-%d digest error: %v", t.Start, t.End, err)
+				continue
+			}
+		} else {
+			// Left failed on error, so the next repair rescans it again.
+			digest, err = rescanTask(ctx, client, limiter, chain, st, scanner, t)
+			if err != nil {
+				log.Printf("Task %d-%d rescan error: %v", t.Start, t.End, err)
+				continue
+			}
+			rescanned++
+		}
+		t.State = taskDone
+		t.Digest = digest
+	}
+	if rescanned > 0 {
+		fmt.Printf("Rescanned %d tasks that no longer matched the chain\n", rescanned)
+	}
+	return remaining
+}
+
+// rescanTask fetches and scans every block of t again and, once all of them
+// have been fetched, replaces the messages stored for its range with the ones
+// found. It returns the task's new digest.
+func rescanTask(ctx context.Context, client blockFetcher, limiter *rateLimiter, chain *Chain, st *store.Buffered, scanner *txmsg.Scanner, t *task) (string, error) {
+	var (
+		hashes []common.Hash
+		blocks []scannedBlock
+		msgs   []txmsg.Message
+	)
+	for blockNum := t.Start; blockNum <= t.End; blockNum++ {
+		if err := limiter.wait(ctx); err != nil {
+			return "", err
+		}
+		num := getBlockNumber(blockNum)
+		block, err := client.BlockByNumber(ctx, num)
+		putBlockNumber(num)
+		if err != nil {
+			return "", fmt.Errorf("block %d: %w", blockNum, err)
+		}
+		b := scannedBlock{num: blockNum, time: block.Time(), msgs: scanner.ScanBlock(ctx, block)}
+		hashes = append(hashes, block.Hash())
+		blocks = append(blocks, b)
+		msgs = append(msgs, b.msgs...)
+	}
+
+	stale, err := st.Query(ctx, store.Query{FromBlock: uint64(t.Start), ToBlock: uint64(t.End)})
+	if err == nil {
+		err = st.Delete(ctx, stale)
+	}
+	if err == nil {
+		err = saveMessages(ctx, st, msgs)
+	}
+	if err != nil {
+		return "", fmt.Errorf("store: %w", err)
+	}
+	for _, b := range blocks {
+		printMessages(chain, uint64(b.num), b.time, "rescanned", b.msgs)
+	}
+	addCoverage(ctx, st, scanner, t.Start, t.End)
+
+	// Digests are defined over the hashes highest block first.
+	slices.Reverse(hashes)
+	return rangeDigest(hashes), nil
+}
+
+// hasSkipped reports whether any of blocks falls inside t.
+func hasSkipped(blocks []skippedBlock, t *task) bool {
+	for _, b := range blocks {
+		if b.Block >= t.Start && b.Block <= t.End {
+			return true
+		}
+	}
+	return false
+}
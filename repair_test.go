@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+var (
+	testKey, _    = crypto.GenerateKey()
+	testRecipient = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	testSigner    = types.LatestSignerForChainID(big.NewInt(1))
+)
+
+// testBlock returns block num on top of parent, with one transaction carrying
+// each of texts as calldata.
+func testBlock(t *testing.T, num int64, parent common.Hash, key *ecdsa.PrivateKey, texts ...string) *types.Block {
+	t.Helper()
+	var txs []*types.Transaction
+	for i, text := range texts {
+		tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+			Nonce:    uint64(i),
+			To:       &testRecipient,
+			Value:    new(big.Int),
+			Gas:      50000,
+			GasPrice: big.NewInt(1),
+			Data:     []byte(text),
+		}), testSigner, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	header := &types.Header{ParentHash: parent, Number: big.NewInt(num), Time: uint64(1700000000 + 12*num)}
+	return types.NewBlock(header, &types.Body{Transactions: txs}, nil, trie.NewStackTrie(nil))
+}
+
+// fakeChain serves blocks by number, failing for the ones marked down.
+type fakeChain struct {
+	blocks map[int64]*types.Block
+	down   map[int64]bool
+}
+
+// newFakeChain returns a chain of blocks 0 to n-1, with texts in the blocks
+// they are keyed by.
+func newFakeChain(t *testing.T, n int64, texts map[int64]string) *fakeChain {
+	c := &fakeChain{blocks: make(map[int64]*types.Block), down: make(map[int64]bool)}
+	var parent common.Hash
+	for num := range n {
+		var b *types.Block
+		if text, ok := texts[num]; ok {
+			b = testBlock(t, num, parent, testKey, text)
+		} else {
+			b = testBlock(t, num, parent, testKey)
+		}
+		c.blocks[num] = b
+		parent = b.Hash()
+	}
+	return c
+}
+
+var errBlockDown = errors.New("block unavailable")
+
+// BlockByNumber implements blockFetcher.
+func (c *fakeChain) BlockByNumber(_ context.Context, number *big.Int) (*types.Block, error) {
+	if c.down[number.Int64()] {
+		return nil, errBlockDown
+	}
+	b, ok := c.blocks[number.Int64()]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b, nil
+}
+
+// HeaderByNumber implements headerFetcher.
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	b, err := c.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return b.Header(), nil
+}
+
+// digest returns the digest of blocks start to end on c.
+func (c *fakeChain) digest(start, end int64) string {
+	var hashes []common.Hash
+	for num := start; num <= end; num++ {
+		hashes = append(hashes, c.blocks[num].Hash())
+	}
+	slices.Reverse(hashes)
+	return rangeDigest(hashes)
+}
+
+// testStore returns an empty in-memory store.
+func testStore(t *testing.T) *store.Buffered {
+	t.Helper()
+	st, err := store.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := store.NewBuffered(st, "")
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// storedTexts returns the texts stored for blocks start to end.
+func storedTexts(t *testing.T, st *store.Buffered, start, end uint64) []string {
+	t.Helper()
+	msgs, err := st.Query(context.Background(), store.Query{FromBlock: start, ToBlock: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, msg := range msgs {
+		texts = append(texts, msg.Text)
+	}
+	slices.Sort(texts)
+	return texts
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain(t, 30, map[int64]string{
+		3:  "please return the funds my friend",
+		14: "the new branch says hello to everyone",
+		25: "this block is still unavailable today",
+	})
+	chain.down[25] = true
+	st := testStore(t)
+
+	// Task 10-19 no longer matched the chain: its stored message came from a
+	// block that was reorged out.
+	stale := testBlock(t, 14, common.Hash{1}, testKey, "a stale message from the old branch")
+	if err := saveMessages(ctx, st, txmsg.NewScanner().ScanBlock(ctx, stale)); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []*task{
+		{Start: 0, End: 9, State: taskFailed},
+		{Start: 10, End: 19, State: taskFailed, Digest: "0xstale"},
+		{Start: 20, End: 29, State: taskFailed},
+	}
+	ledger := []skippedBlock{{3, "timeout"}, {25, "timeout"}}
+	limiter := newRateLimiter(ctx, 1e6, 1)
+	remaining := repair(ctx, chain, limiter, &Chain{Name: "mainnet"}, st, txmsg.NewScanner(), ledger, tasks)
+
+	if len(remaining) != 1 || remaining[0].Block != 25 || remaining[0].Reason != errBlockDown.Error() {
+		t.Errorf("remaining = %+v, want block 25 with its new error", remaining)
+	}
+	for _, tt := range []struct {
+		task   *task
+		state  string
+		digest string
+		texts  []string
+	}{
+		{tasks[0], taskDone, chain.digest(0, 9), []string{"please return the funds my friend"}},
+		{tasks[1], taskDone, chain.digest(10, 19), []string{"the new branch says hello to everyone"}},
+		{tasks[2], taskFailed, "", nil},
+	} {
+		if tt.task.State != tt.state || tt.task.Digest != tt.digest {
+			t.Errorf("task %d-%d = %s %s, want %s %s", tt.task.Start, tt.task.End, tt.task.State, tt.task.Digest, tt.state, tt.digest)
+		}
+		if got := storedTexts(t, st, uint64(tt.task.Start), uint64(tt.task.End)); !slices.Equal(got, tt.texts) {
+			t.Errorf("task %d-%d stored %q, want %q", tt.task.Start, tt.task.End, got, tt.texts)
+		}
+	}
+}
+
+func TestHasSkipped(t *testing.T) {
+	blocks := []skippedBlock{{Block: 9}, {Block: 20}}
+	for _, tt := range []struct {
+		start, end int64
+		want       bool
+	}{
+		{0, 8, false},
+		{0, 9, true},
+		{10, 19, false},
+		{20, 29, true},
+	} {
+		if got := hasSkipped(blocks, &task{Start: tt.start, End: tt.end}); got != tt.want {
+			t.Errorf("hasSkipped(%d-%d) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// runReplay feeds previously captured messages (NDJSON from -out files,
+// query -json or stdin, gzipped or not) back through printing and storage, as
+// if they had just been scanned: e.g. to load -out files into a database.
+// Messages already stored are skipped as usual.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	input := fs.String("input", "", "NDJSON file of messages, optionally .gz (default: standard input)")
+	dbPath := fs.String("db", "", dbUsage)
+	keywordList := fs.String("keywords", "", "comma-separated keywords; only messages mentioning one are printed (all are stored)")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	var in io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fatalf(exitFailure, "Input error: %v", err)
+		}
+		defer f.Close()
+		in = f
+		if strings.HasSuffix(*input, ".gz") {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				fatalf(exitFailure, "Input error: %v", err)
+			}
+			in = zr
+		}
+	}
+	var keywords []string
+	for _, k := range strings.Split(*keywordList, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+
+	chain := chainOpts.lookup()
+	st := openStore(chainOpts.dbPath(*dbPath))
+	defer st.Close()
+	ctx := context.Background()
+
+	// Messages of a block are replayed together, as a scan would emit them.
+	var block []txmsg.Message
+	total := 0
+	flush := func() {
+		if len(block) == 0 {
+			return
+		}
+		printMessages(chain, block[0].Block, block[0].Time, "replayed", filterKeywords(block, keywords))
+		if err := saveMessages(ctx, st, block); err != nil {
+			log.Printf("Store error: %v", err)
+		}
+		total += len(block)
+		block = nil
+	}
+
+	lines := bufio.NewScanner(in)
+	lines.Buffer(nil, 1<<20)
+	for lineNum := 1; lines.Scan(); lineNum++ {
+		if len(strings.TrimSpace(lines.Text())) == 0 {
+			continue
+		}
+		var msg txmsg.Message
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil {
+			log.Printf("Line %d error: %v", lineNum, err)
+			continue
+		}
+		if len(block) > 0 && (msg.Block != block[0].Block || msg.Time != block[0].Time) {
+			flush()
+		}
+		block = append(block, msg)
+	}
+	flush()
+	if err := lines.Err(); err != nil {
+		fatalf(exitFailure, "Input error: %v", err)
+	}
+	fmt.Printf("Replayed %d messages\n", total)
+}
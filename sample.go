@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// sampleSegments is the number of equal parts of the range a sampling
+// survey reports on.
+const sampleSegments = 10
+
+// parseSample parses a -sample spec of the form "every=N".
+func parseSample(spec string) (int64, error) {
+	key, value, ok := strings.Cut(spec, "=")
+	if !ok || key != "every" {
+		return 0, fmt.Errorf("unknown sample spec %q (want every=N)", spec)
+	}
+	every, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || every < 1 {
+		return 0, fmt.Errorf("invalid sample interval %q", value)
+	}
+	return every, nil
+}
+
+// steppedRange yields every step-th block number from start to end inclusive.
+func steppedRange(start, end, step int64) iter.Seq[int64] {
+	return func(yield func(int64) bool) {
+		for n := start; n <= end; n += step {
+			if !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+// surveySegment tallies the sampled blocks in one part of the range.
+type surveySegment struct {
+	start, end int64
+	sampled    int
+	withMsgs   int
+	msgs       int
+	failed     int
+}
+
+// runSample scans the blocks yielded by nums, printing and storing their
+// messages like a regular scan but without touching the manifest or the
+// checkpoint, then prints how common messages were across the range. Blocks
+// that couldn't be scanned are added to the skipped-block ledger for repair,
+// and returned.
+func runSample(ctx context.Context, client blockFetcher, chain *Chain, scanner *txmsg.Scanner, st *store.Buffered,
+	start, end int64, nums iter.Seq[int64], workers int, limiter *rateLimiter, keywords []string) []int64 {
+	if start > end {
+		fatalf(exitUsage, "Nothing to sample: block %d is past %d", start, end)
+	}
+	segSize := max((end-start+1+sampleSegments-1)/sampleSegments, 1)
+	var segments []*surveySegment
+	for s := start; s <= end; s += segSize {
+		segments = append(segments, &surveySegment{start: s, end: min(s+segSize-1, end)})
+	}
+
+	var total surveySegment
+	var skipped []int64
+	for b := range fetchBlocks(ctx, client, scanner, nums, workers, limiter) {
+		if ctx.Err() != nil {
+			log.Printf("Interrupted at block %d", b.num)
+			break
+		}
+		seg := segments[(b.num-start)/segSize]
+		if err := storeBlock(ctx, chain, st, b, keywords); err != nil {
+			log.Printf("Block %d scan error: %v", b.num, err)
+			if err := appendSkipped(chain.file(skippedFile), b.num, err); err != nil {
+				log.Printf("Ledger save error: %v", err)
+			}
+			seg.failed++
+			total.failed++
+			skipped = append(skipped, b.num)
+			continue
+		}
+		for _, s := range []*surveySegment{seg, &total} {
+			s.sampled++
+			s.msgs += len(b.msgs)
+			if len(b.msgs) > 0 {
+				s.withMsgs++
+			}
+		}
+	}
+
+	fmt.Printf("\nSurvey of blocks %d-%d\n", start, end)
+	for _, s := range segments {
+		printSegment(fmt.Sprintf("%d-%d", s.start, s.end), s)
+	}
+	printSegment("total", &total)
+	return skipped
+}
+
+// printSegment prints one line of the sampling survey.
+func printSegment(label string, s *surveySegment) {
+	pct := 0.0
+	if s.sampled > 0 {
+		pct = 100 * float64(s.withMsgs) / float64(s.sampled)
+	}
+	fmt.Printf("  %-23s %6d sampled  %6d with messages (%5.1f%%)  %7d messages", label, s.sampled, s.withMsgs, pct, s.msgs)
+	if s.failed > 0 {
+		fmt.Printf("  %d failed", s.failed)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// inTempDir runs the rest of the test in a temporary working directory, where
+// the chain files are written.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestParseSample(t *testing.T) {
+	for spec, want := range map[string]int64{"every=1": 1, "every=1000": 1000} {
+		if got, err := parseSample(spec); err != nil || got != want {
+			t.Errorf("parseSample(%q) = %d, %v; want %d", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"", "every", "every=", "every=0", "every=-5", "every=x", "each=10", "10"} {
+		if _, err := parseSample(spec); err == nil {
+			t.Errorf("parseSample(%q) accepted", spec)
+		}
+	}
+}
+
+func TestSteppedRange(t *testing.T) {
+	for _, tt := range []struct {
+		start, end, step int64
+		want             []int64
+	}{
+		{0, 10, 5, []int64{0, 5, 10}},
+		{3, 10, 4, []int64{3, 7}},
+		{7, 7, 100, []int64{7}},
+		{8, 7, 1, nil},
+	} {
+		if got := slices.Collect(steppedRange(tt.start, tt.end, tt.step)); !slices.Equal(got, tt.want) {
+			t.Errorf("steppedRange(%d, %d, %d) = %v, want %v", tt.start, tt.end, tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestRunSample(t *testing.T) {
+	inTempDir(t)
+	ctx := context.Background()
+	chain := newFakeChain(t, 30, map[int64]string{
+		10: "a message in a sampled block here",
+		12: "a message between the sampled blocks",
+		20: "another message in a sampled block",
+	})
+	chain.down[15] = true
+	st := testStore(t)
+	c := &Chain{Name: "mainnet"}
+
+	limiter := newRateLimiter(ctx, 1e6, 2)
+	skipped := runSample(ctx, chain, c, txmsg.NewScanner(), st, 0, 29, steppedRange(0, 29, 5), 2, limiter, nil)
+	if !slices.Equal(skipped, []int64{15}) {
+		t.Errorf("skipped = %v, want [15]", skipped)
+	}
+	want := []string{"a message in a sampled block here", "another message in a sampled block"}
+	if got := storedTexts(t, st, 0, 29); !slices.Equal(got, want) {
+		t.Errorf("stored %q, want %q", got, want)
+	}
+	ledger, err := readSkipped(c.file(skippedFile))
+	if err != nil || len(ledger) != 1 || ledger[0].Block != 15 {
+		t.Errorf("ledger = %v, %v; want block 15", ledger, err)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"iter"
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// blockFetcher is the part of ethclient.Client the scan pipeline needs.
+type blockFetcher interface {
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
+// scannedBlock is the outcome of fetching and scanning one block.
+type scannedBlock struct {
+	num  int64
+	hash common.Hash
+	time uint64
+	msgs []txmsg.Message
+	note string // Shown next to the block header, e.g. a timestamp anomaly
+	err  error
+}
+
+// runScan is the default command. It scans a block range, by default resuming
+// after the stored checkpoint (or scanDepth blocks below the head on the first
+// run), fetching blocks concurrently but printing and storing them in order.
+// SIGINT and SIGTERM stop the scan after the block in hand.
+func runScan(args []string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	scanUntil(ctx, args)
+}
+
+// scanUntil runs the scan command until it is done or ctx is cancelled, then
+// flushes the store and completes the -out file before returning.
+func scanUntil(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	watch := fs.Bool("watch", false, "follow new blocks as they arrive instead of scanning a range")
+	dbPath := fs.String("db", "", dbUsage)
+	storeKind := fs.String("store", "sqlite", "message store: sqlite (the -db file) or memory (write no files)")
+	outDir := fs.String("out", "", "also write messages as NDJSON to rotating, gzipped files in this directory")
+	outSize := fs.Int64("out-size", 64, "complete an -out file once it reaches this many MiB")
+	outAge := fs.Duration("out-age", 24*time.Hour, "complete an -out file once it has been open this long")
+	chainOpts := addChainFlags(fs, "mainnet")
+	startFlag := fs.Int64("start-block", -1, "first block to scan (default: resume from the checkpoint)")
+	endFlag := fs.Int64("end-block", -1, "last block to scan (default: the current head)")
+	workers := fs.Int("workers", defaultWorkers, "number of concurrent block fetches")
+	rate := fs.Float64("rate", defaultRate, "maximum RPC requests per second")
+	maxSkew := fs.Duration("max-skew", defaultMaxSkew, "flag block timestamps further ahead of the local clock than this")
+	presetName := fs.String("preset", "", "scan a notable period: "+strings.Join(presetNames(), ", "))
+	sampleSpec := fs.String("sample", "", "scan only every Nth block (every=N) of the range, from block 0 unless -start-block is given, and print a survey")
+	keywordList := fs.String("keywords", "", "comma-separated keywords; only messages mentioning one are printed (all are stored)")
+	lease := fs.Duration("leader-lease", 0, "with -watch, elect one writer among watchers sharing -db, failing over after this long (0: always write)")
+	parseFlags(fs, args)
+
+	if *workers < 1 || !(*rate > 0) {
+		fatalf(exitUsage, "-workers and -rate must be positive")
+	}
+
+	// Registered first so that it exits only after the store is closed.
+	var skipped []int64
+	defer func() { exitIfSkipped(skipped) }()
+
+	var st *store.Buffered
+	switch *storeKind {
+	case "sqlite":
+		st = openStore(chainOpts.dbPath(*dbPath))
+	case "memory":
+		ephemeral = true
+		st = openMemoryStore()
+	default:
+		fatalf(exitUsage, "Unknown -store %q; use sqlite or memory", *storeKind)
+	}
+	defer st.Close()
+	if *outDir != "" {
+		if *outSize <= 0 || *outAge <= 0 {
+			fatalf(exitUsage, "-out-size and -out-age must be positive")
+		}
+		var err error
+		if output, err = newRotatingWriter(*outDir, *outSize<<20, *outAge); err != nil {
+			fatalf(exitFailure, "Output error: %v", err)
+		}
+		defer func() {
+			if err := output.Close(); err != nil {
+				log.Printf("Output error: %v", err)
+			}
+		}()
+	}
+
+	chain := chainOpts.resolve()
+	var keywords []string
+	for _, k := range strings.Split(*keywordList, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	if *presetName != "" {
+		if *watch {
+			fatalf(exitUsage, "-preset scans a past block range and can't be combined with -watch")
+		}
+		p := lookupPreset(*presetName, chain)
+		fmt.Printf("Preset %s: %s, blocks %d-%d\n", *presetName, p.Description, p.Start, p.End)
+		if *startFlag < 0 {
+			*startFlag = p.Start
+		}
+		if *endFlag < 0 {
+			*endFlag = p.End
+		}
+		if keywords == nil {
+			keywords = p.Keywords
+		}
+	}
+
+	var every int64
+	if *sampleSpec != "" {
+		var err error
+		if every, err = parseSample(*sampleSpec); err != nil {
+			fatalf(exitUsage, "%v", err)
+		}
+		if *watch {
+			fatalf(exitUsage, "-sample can't be combined with -watch")
+		}
+	}
+
+	scanner := chainOpts.scanner()
+	if *watch {
+		runWatch(ctx, chain, scanner, st, *maxSkew, keywords, *lease)
+		return
+	}
+
+	client := chain.dial()
+
+	endBlock := *endFlag
+	if endBlock < 0 {
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			fatalf(exitProvider, "Block header error: %v", err)
+		}
+		endBlock = header.Number.Int64()
+	}
+
+	limiter := newRateLimiter(ctx, *rate, *workers)
+	if every > 0 {
+		startBlock := max(*startFlag, 0)
+		nums := steppedRange(startBlock, endBlock, every)
+		skipped = runSample(ctx, client, chain, scanner, st, startBlock, endBlock, nums, *workers, limiter, keywords)
+		return
+	}
+
+	// An explicit start block scans exactly that range and leaves the
+	// checkpoint alone; otherwise resume after the last scanned block, or
+	// start scanDepth blocks back.
+	startBlock := *startFlag
+	resume := startBlock < 0
+	if resume {
+		startBlock = max(endBlock-scanDepth, 0)
+		checkpoint, ok, err := st.Checkpoint(ctx)
+		if err != nil {
+			fatalf(exitFailure, "Checkpoint error: %v", err)
+		}
+		if ok {
+			startBlock = int64(checkpoint) + 1
+		}
+	}
+	if startBlock > endBlock {
+		fmt.Printf("Up to date at block %d\n", endBlock)
+		return
+	}
+
+	m, err := loadManifest(chain.file(manifestFile))
+	if err != nil {
+		fatalf(exitFailure, "Manifest error: %v", err)
+	}
+	tasks := m.plan(startBlock, endBlock)
+	// Only the tasks this scan covers in full start over. A topmost task that
+	// reaches past endBlock was scanned before up to a later head, and keeps
+	// its state and digest unless one of its rescanned blocks fails.
+	for _, t := range tasks {
+		if t.End <= endBlock {
+			t.State = taskPending
+			t.Digest = ""
+		}
+	}
+	if err := m.save(); err != nil {
+		log.Printf("Manifest save error: %v", err)
+	}
+
+	blocks := fetchBlocks(ctx, client, scanner, blockRange(tasks[0].Start, endBlock), *workers, limiter)
+
+	// Blocks arrive in order, so each task completes when its last block does.
+	var hashes []common.Hash
+	var prev scannedBlock
+	failed := false
+	t := tasks[0]
+	covered := t.Start // start of the current run of scanned blocks
+	for b := range blocks {
+		if ctx.Err() != nil {
+			log.Printf("Interrupted at block %d", b.num)
+			return
+		}
+		if b.err == nil {
+			var parentTime uint64
+			if prev.err == nil && prev.num == b.num-1 {
+				parentTime = prev.time
+			}
+			if anomaly := timestampAnomaly(b.time, parentTime, time.Now(), *maxSkew); anomaly != "" {
+				log.Printf("Block %d %s", b.num, anomaly)
+				b.note = anomaly
+			}
+		}
+		prev = b
+		if err := storeBlock(ctx, chain, st, b, keywords); err != nil {
+			log.Printf("Block %d scan error: %v", b.num, err)
+			if err := appendSkipped(chain.file(skippedFile), b.num, err); err != nil {
+				log.Printf("Ledger save error: %v", err)
+			}
+			failed = true
+			skipped = append(skipped, b.num)
+			addCoverage(ctx, st, scanner, covered, b.num-1)
+			covered = b.num + 1
+		} else {
+			hashes = append(hashes, b.hash)
+		}
+		if b.num < min(t.End, endBlock) {
+			continue
+		}
+
+		switch {
+		case t.End <= endBlock:
+			finishTask(m, t, hashes, failed)
+		case failed:
+			finishTask(m, t, nil, true)
+		}
+		addCoverage(ctx, st, scanner, covered, b.num)
+		covered = b.num + 1
+		if resume {
+			// A later task moves the checkpoint past this one if the store recovers.
+			if err := st.SetCheckpoint(ctx, uint64(b.num)); err != nil {
+				log.Printf("Checkpoint error: %v", err)
+			}
+		}
+		hashes, failed = nil, false
+		if tasks = tasks[1:]; len(tasks) > 0 {
+			t = tasks[0]
+		}
+	}
+}
+
+// storeBlock prints the messages of a scanned block that mention any of
+// keywords (all of them if there are none) and saves every message to the store.
+func storeBlock(ctx context.Context, chain *Chain, st *store.Buffered, b scannedBlock, keywords []string) error {
+	if b.err != nil {
+		return b.err
+	}
+	printMessages(chain, uint64(b.num), b.time, b.note, filterKeywords(b.msgs, keywords))
+	if err := saveMessages(ctx, st, b.msgs); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	return nil
+}
+
+// addCoverage records blocks start to end, if any, as scanned in the store.
+func addCoverage(ctx context.Context, st *store.Buffered, scanner *txmsg.Scanner, start, end int64) {
+	if start > end {
+		return
+	}
+	if err := st.AddCoverage(ctx, uint64(start), uint64(end), scanner.Provenance); err != nil {
+		log.Printf("Coverage error: %v", err)
+	}
+}
+
+// finishTask records the outcome of t in the manifest. A task with any block
+// that couldn't be fetched or stored is failed; its blocks are in the ledger.
+func finishTask(m *manifest, t *task, hashes []common.Hash, failed bool) {
+	if failed {
+		t.State = taskFailed
+	} else {
+		// Digests are defined over the hashes highest block first.
+		slices.Reverse(hashes)
+		t.State = taskDone
+		t.Digest = rangeDigest(hashes)
+	}
+	if err := m.save(); err != nil {
+		log.Printf("Manifest save error: %v", err)
+	}
+}
+
+// blockRange yields the block numbers from start to end inclusive.
+func blockRange(start, end int64) iter.Seq[int64] {
+	return func(yield func(int64) bool) {
+		for n := start; n <= end; n++ {
+			if !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+// fetchBlocks fetches and scans the blocks in nums with the given number of
+// workers and returns them, in the order of nums, on the returned channel. At
+// most 2*workers blocks are held ahead of the consumer.
+func fetchBlocks(ctx context.Context, client blockFetcher, scanner *txmsg.Scanner, nums iter.Seq[int64], workers int, limiter *rateLimiter) <-chan scannedBlock {
+	type job struct {
+		num int64
+		out chan scannedBlock
+	}
+	jobs := make(chan job)
+	pending := make(chan chan scannedBlock, 2*workers)
+
+	// Hand out jobs in order, queueing each result slot as it goes.
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for num := range nums {
+			out := make(chan scannedBlock, 1)
+			select {
+			case pending <- out:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job{num: num, out: out}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.out <- fetchBlock(ctx, client, scanner, j.num, limiter)
+			}
+		}()
+	}
+
+	// Drain the result slots in the order they were queued.
+	results := make(chan scannedBlock)
+	go func() {
+		defer close(results)
+		for out := range pending {
+			results <- <-out
+		}
+		wg.Wait()
+	}()
+	return results
+}
+
+// fetchBlock fetches and scans a block, retrying with exponential backoff.
+func fetchBlock(ctx context.Context, client blockFetcher, scanner *txmsg.Scanner, blockNum int64, limiter *rateLimiter) scannedBlock {
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Block %d fetch error: %v (retrying in %s)", blockNum, err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return scannedBlock{num: blockNum, err: ctx.Err()}
+			}
+			backoff *= 2
+		}
+		if err = limiter.wait(ctx); err != nil {
+			break
+		}
+
+		num := getBlockNumber(blockNum)
+		block, fetchErr := client.BlockByNumber(ctx, num)
+		putBlockNumber(num)
+		if err = fetchErr; err == nil {
+			return scannedBlock{
+				num:  blockNum,
+				hash: block.Hash(),
+				time: block.Time(),
+				msgs: scanner.ScanBlock(ctx, block),
+			}
+		}
+	}
+	return scannedBlock{num: blockNum, err: err}
+}
+
+// rateLimiter is a token bucket shared by all workers.
+type rateLimiter struct {
+	tokens chan struct{}
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second with the
+// given burst. The refill goroutine stops when ctx is done.
+func newRateLimiter(ctx context.Context, rate float64, burst int) *rateLimiter {
+	l := &rateLimiter{tokens: make(chan struct{}, burst)}
+	for range burst {
+		l.tokens <- struct{}{}
+	}
+	// Rates above one per nanosecond would round to a zero interval, which
+	// NewTicker rejects.
+	interval := max(time.Duration(float64(time.Second)/rate), time.Nanosecond)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case l.tokens <- struct{}{}:
+				default: // bucket full
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return l
+}
+
+// wait blocks until a token is available or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	select {
+	case <-l.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends state (e.g. "READY=1") to the service manager over
+// $NOTIFY_SOCKET. It does nothing unless the process was started by systemd
+// with Type=notify.
+func sdNotify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	if path[0] == '@' {
+		path = "\x00" + path[1:] // abstract socket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often to send WATCHDOG=1 when systemd's
+// watchdog is enabled for this process (WatchdogSec=): half the timeout, as
+// sd_watchdog_enabled(3) recommends. It returns 0 if the watchdog is off.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// listenFDsStart is the first file descriptor systemd passes to a
+// socket-activated process (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// systemdListener returns the first listening socket systemd passed to a
+// socket-activated process (ListenStream= in a .socket unit), or nil if it
+// passed none.
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	// Not for child processes, as sd_listen_fds(3) does.
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(name)
+	}
+	f := os.NewFile(listenFDsStart, "systemd socket")
+	defer f.Close()
+	return net.FileListener(f)
+}
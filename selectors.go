@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// normalize validates the selectors and rewrites them as the scanner keys
+// them: lowercase hex without 0x.
+func (sc *SelectorsConfig) normalize() error {
+	if sc == nil {
+		return nil
+	}
+	for i, sel := range sc.Allow {
+		norm, err := normalizeSelector(sel)
+		if err != nil {
+			return err
+		}
+		sc.Allow[i] = norm
+	}
+	block := make(map[string]string, len(sc.Block))
+	for sel, desc := range sc.Block {
+		norm, err := normalizeSelector(sel)
+		if err != nil {
+			return err
+		}
+		block[norm] = desc
+	}
+	sc.Block = block
+	return nil
+}
+
+// apply adds the blocked selectors to s and removes the allowed ones.
+func (sc *SelectorsConfig) apply(s *txmsg.Scanner) {
+	if sc == nil {
+		return
+	}
+	maps.Copy(s.Selectors, sc.Block)
+	for _, sel := range sc.Allow {
+		delete(s.Selectors, sel)
+	}
+}
+
+// normalizeSelector returns sel as 8 lowercase hex digits without 0x.
+func normalizeSelector(sel string) (string, error) {
+	norm := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(sel, "0x"), "0X"))
+	if b, err := hex.DecodeString(norm); err != nil || len(b) != 4 {
+		return "", fmt.Errorf("invalid selector %q", sel)
+	}
+	return norm, nil
+}
+
+// selectorText returns the selector's bytes as text, if they are all
+// printable ASCII. Calldata starting with such a selector may well be a
+// message, which isContractCall would skip.
+func selectorText(sel string) (string, bool) {
+	b, err := hex.DecodeString(sel)
+	if err != nil {
+		return "", false
+	}
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return "", false
+		}
+	}
+	return string(b), true
+}
+
+// runSelectors handles "selectors report", which lists the selectors of the
+// selected chain's scanner whose bytes are printable text: messages starting
+// with that text are mistaken for contract calls and skipped.
+func runSelectors(args []string) {
+	if len(args) == 0 || args[0] != "report" {
+		fatalf(exitUsage, "usage: selectors report [-all] [-config file] [-chain name]")
+	}
+	fs := flag.NewFlagSet("selectors report", flag.ExitOnError)
+	all := fs.Bool("all", false, "list every selector, not only the printable ones")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args[1:])
+
+	scanner := chainOpts.scanner()
+	sc := chainOpts.loadConfig().Selectors
+	allowed := make(map[string]bool)
+	if sc != nil {
+		for _, sel := range sc.Allow {
+			allowed[sel] = true
+		}
+	}
+	// The selector database is what the scanner skips plus what was allowed
+	// out of it.
+	descs := maps.Clone(scanner.Selectors)
+	for sel := range allowed {
+		if _, ok := descs[sel]; !ok {
+			descs[sel] = txmsg.KnownSelectors[sel]
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SELECTOR\tTEXT\tSTATUS\tDESCRIPTION")
+	risky := 0
+	for _, sel := range slices.Sorted(maps.Keys(descs)) {
+		text, printable := selectorText(sel)
+		status := "skipped"
+		switch {
+		case allowed[sel]:
+			status = "allowed"
+		case printable:
+			status = "skipped, risky"
+			risky++
+		}
+		if !printable && !*all {
+			continue
+		}
+		if printable {
+			text = fmt.Sprintf("%q", text)
+		} else {
+			text = "-"
+		}
+		fmt.Fprintf(w, "0x%s\t%s\t%s\t%s\n", sel, text, status, descs[sel])
+	}
+	w.Flush()
+	fmt.Printf("\n%d of %d selectors are printable text and still skipped", risky, len(descs))
+	if risky > 0 {
+		fmt.Printf("; add them to \"selectors\": {\"allow\": [...]} in %s to decode such calldata", *chainOpts.config)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// maxServeLimit caps the number of messages one request returns.
+const maxServeLimit = 1000
+
+// HTTP server timeouts, so that slow or idle clients can't hold connections
+// open indefinitely.
+const (
+	serveReadHeaderTimeout = 5 * time.Second
+	serveReadTimeout       = 10 * time.Second
+	serveWriteTimeout      = time.Minute
+	serveIdleTimeout       = 2 * time.Minute
+	serveShutdownTimeout   = 10 * time.Second // How long requests in flight may take to finish on shutdown
+)
+
+// runServe serves read-only queries of the message database over HTTP. It
+// doesn't scan, so query traffic can run on other machines than the indexer,
+// against a copy or a shared volume of its database.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbPath := fs.String("db", "", dbUsage)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	path := chainOpts.dbPath(*dbPath)
+	st, err := store.OpenReadOnly(path)
+	if err != nil {
+		fatalf(exitStore, "Store error: %v", err)
+	}
+	defer st.Close()
+
+	err = listenAndServe(*addr, serveHandler(st), func(addr net.Addr) {
+		log.Printf("Serving %s on http://%s", path, addr)
+	})
+	if err != nil {
+		fatalf(exitFailure, "Server error: %v", err)
+	}
+}
+
+// listenAndServe serves handler on addr, or on the socket systemd passed if
+// the process was socket-activated, calling started once it listens. On
+// SIGINT or SIGTERM it stops accepting connections and returns once the
+// requests in flight have finished, or after serveShutdownTimeout.
+func listenAndServe(addr string, handler http.Handler, started func(addr net.Addr)) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l, err := systemdListener()
+	if err == nil && l == nil {
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		WriteTimeout:      serveWriteTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(l) }()
+	started(l.Addr())
+	if err := sdNotify("READY=1"); err != nil {
+		log.Printf("Notify error: %v", err)
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down")
+	sdNotify("STOPPING=1")
+	ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// serveHandler routes the API's requests to st.
+func serveHandler(st *store.Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /messages", func(w http.ResponseWriter, r *http.Request) {
+		serveMessages(st, w, r)
+	})
+	mux.HandleFunc("GET /coverage", func(w http.ResponseWriter, r *http.Request) {
+		serveCoverage(st, w, r)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		serveStatus(st, w, r)
+	})
+	mux.HandleFunc("GET /motd", func(w http.ResponseWriter, r *http.Request) {
+		serveMotd(st, w, r)
+	})
+	mux.HandleFunc("GET /onthisday", func(w http.ResponseWriter, r *http.Request) {
+		serveOnThisDay(st, w, r)
+	})
+	return mux
+}
+
+// serveMessages answers GET /messages with one JSON object per line for each
+// message matching the query parameters, which mirror the query command's
+// flags: keyword, address, tx, from, to and limit.
+func serveMessages(st *store.Store, w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msgs, err := st.Query(r.Context(), q)
+	if err == nil {
+		err = st.Attribute(r.Context(), msgs)
+	}
+	if err != nil {
+		log.Printf("Query error: %v", err)
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			return // the client went away
+		}
+	}
+}
+
+// serveStatus answers GET /status with the last block in the database, which
+// shows how far a replica lags behind the indexer.
+func serveStatus(st *store.Store, w http.ResponseWriter, r *http.Request) {
+	checkpoint, ok, err := st.Checkpoint(r.Context())
+	if err != nil {
+		log.Printf("Checkpoint error: %v", err)
+		http.Error(w, "status failed", http.StatusInternalServerError)
+		return
+	}
+	status := struct {
+		Checkpoint *uint64 `json:"checkpoint"`
+	}{}
+	if ok {
+		status.Checkpoint = &checkpoint
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// serveCoverage answers GET /coverage with the scanned block ranges, with
+// the configuration that scanned them, and the gaps between them.
+func serveCoverage(st *store.Store, w http.ResponseWriter, r *http.Request) {
+	ranges, err := st.Coverage(r.Context())
+	if err != nil {
+		log.Printf("Coverage error: %v", err)
+		http.Error(w, "coverage failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coverageReport{Ranges: ranges, Gaps: store.Gaps(ranges)})
+}
+
+// serveMotd answers GET /motd with the message of the day picked as the
+// highlight command does, for the day given as date=YYYY-MM-DD (default:
+// yesterday, UTC). The message is null if no message of that day is eligible.
+func serveMotd(st *store.Store, w http.ResponseWriter, r *http.Request) {
+	day, err := parseDay(r.URL.Query().Get("date"), time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid date %q", r.URL.Query().Get("date")), http.StatusBadRequest)
+		return
+	}
+	best, ok, _, err := highlight(r.Context(), st, day)
+	if err != nil {
+		log.Printf("Highlight error: %v", err)
+		http.Error(w, "highlight failed", http.StatusInternalServerError)
+		return
+	}
+	motd := struct {
+		Date    string         `json:"date"`
+		Message *txmsg.Message `json:"message"`
+	}{Date: day.Format(time.DateOnly)}
+	if ok {
+		motd.Message = &best
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(motd)
+}
+
+// serveOnThisDay answers GET /onthisday with the messages posted on the same
+// calendar day in earlier years, like the onthisday command: date=YYYY-MM-DD
+// (default: today, UTC), years (default: every earlier year) and limit per
+// year (default 20, at most maxServeLimit).
+func serveOnThisDay(st *store.Store, w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query()
+	day, err := parseDay(p.Get("date"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid date %q", p.Get("date")), http.StatusBadRequest)
+		return
+	}
+	years, limit := 0, 20
+	for _, f := range []struct {
+		name string
+		v    *int
+	}{{"years", &years}, {"limit", &limit}} {
+		if s := p.Get(f.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("invalid %s %q", f.name, s), http.StatusBadRequest)
+				return
+			}
+			*f.v = n
+		}
+	}
+	found, err := onThisDay(r.Context(), st, day, years, min(limit, maxServeLimit))
+	if err != nil {
+		log.Printf("Query error: %v", err)
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	if found == nil {
+		found = []yearAgo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// parseQuery builds a store query from r's parameters. The limit defaults to
+// and is capped at maxServeLimit.
+func parseQuery(r *http.Request) (store.Query, error) {
+	p := r.URL.Query()
+	q := store.Query{Keyword: p.Get("keyword"), Limit: maxServeLimit}
+	if s := p.Get("address"); s != "" {
+		if !common.IsHexAddress(s) {
+			return q, fmt.Errorf("invalid address %q", s)
+		}
+		addr := common.HexToAddress(s)
+		q.Address = &addr
+	}
+	if s := p.Get("tx"); s != "" {
+		if len(s) != 66 || !strings.HasPrefix(s, "0x") {
+			return q, fmt.Errorf("invalid transaction hash %q", s)
+		}
+		hash := common.HexToHash(s)
+		q.TxHash = &hash
+	}
+	for _, f := range []struct {
+		name string
+		v    *uint64
+	}{{"from", &q.FromBlock}, {"to", &q.ToBlock}} {
+		if s := p.Get(f.name); s != "" {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s block %q", f.name, s)
+			}
+			*f.v = n
+		}
+	}
+	if s := p.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return q, fmt.Errorf("invalid limit %q", s)
+		}
+		q.Limit = min(n, maxServeLimit)
+	}
+	return q, nil
+}
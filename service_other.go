@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// runService is only available on Windows; elsewhere, run watch mode under the
+// system's service manager, e.g. as a systemd Type=notify service.
+func runService(args []string) {
+	fatalf(exitUsage, "service is only available on Windows; run -watch under systemd instead")
+}
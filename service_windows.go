@@ -0,0 +1,163 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Windows service defaults.
+const (
+	serviceName    = "txmsg-r"
+	serviceLogFile = "txmsg.log" // Output of the service, in its working directory
+)
+
+// runService handles "service install|uninstall|run", which run watch mode as
+// a Windows service. Services start in the system directory, so the service
+// changes to the directory it was installed from (or -dir) before reading its
+// configuration, database and ledgers.
+func runService(args []string) {
+	if len(args) == 0 {
+		fatalf(exitUsage, "usage: service install|uninstall|run [-name %s] [-dir path] [-- watch flags]", serviceName)
+	}
+	fs := flag.NewFlagSet("service "+args[0], flag.ExitOnError)
+	name := fs.String("name", serviceName, "service name")
+	dir := fs.String("dir", "", "working directory of the service (default: the current directory)")
+	parseFlags(fs, args[1:])
+
+	switch args[0] {
+	case "install":
+		if *dir == "" {
+			wd, err := os.Getwd()
+			if err != nil {
+				fatalf(exitFailure, "Service error: %v", err)
+			}
+			*dir = wd
+		}
+		if err := installService(*name, *dir, fs.Args()); err != nil {
+			fatalf(exitFailure, "Service install error: %v", err)
+		}
+		fmt.Printf("Installed service %s running in %s; start it with: sc start %s\n", *name, *dir, *name)
+	case "uninstall":
+		if err := uninstallService(*name); err != nil {
+			fatalf(exitFailure, "Service uninstall error: %v", err)
+		}
+		fmt.Printf("Removed service %s\n", *name)
+	case "run":
+		if ok, err := svc.IsWindowsService(); err != nil || !ok {
+			fatalf(exitUsage, "service run is started by the service manager; use service install")
+		}
+		if err := svc.Run(*name, &watchService{dir: *dir, args: fs.Args()}); err != nil {
+			fatalf(exitFailure, "Service error: %v", err)
+		}
+	default:
+		fatalf(exitUsage, "Unknown service command %q", args[0])
+	}
+}
+
+// installService registers this executable as an automatically started
+// service running watch mode with watchArgs in dir, restarted if it fails.
+func installService(name, dir string, watchArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	args := append([]string{"service", "run", "-name", name, "-dir", dir, "--"}, watchArgs...)
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "txmsg-r watcher",
+		Description: "Follows the chain head and records messages found in transaction calldata.",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// Restart after any failure, including fatal errors that exit cleanly.
+	restart := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 10 * time.Second}}
+	if err := s.SetRecoveryActions(restart, uint32((24 * time.Hour).Seconds())); err != nil {
+		return err
+	}
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
+// uninstallService removes the service called name.
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Delete()
+}
+
+// watchService runs watch mode under the service manager.
+type watchService struct {
+	dir  string
+	args []string // Extra flags for watch mode
+}
+
+// Execute implements svc.Handler. Watch mode runs until the service is
+// stopped; its output goes to serviceLogFile in the working directory.
+func (s *watchService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	if err := os.Chdir(s.dir); err != nil {
+		return true, 1
+	}
+	out, err := os.OpenFile(serviceLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return true, 1
+	}
+	defer out.Close()
+	os.Stdout, os.Stderr = out, out
+	log.SetOutput(out)
+
+	// Stopping cancels the watch, which then closes the store and the -out
+	// file; the service reports stopped only once it has returned.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanUntil(ctx, append([]string{"-watch"}, s.args...))
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return true, 1 // watch mode only returns once cancelled
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// sqlTemplates hold the warehouse queries generated by the sql command, keyed by
+// dialect. They reproduce the scanner's pre-filters (non-empty calldata, no
+// known function selector, a regex candidate match); the word and letter-ratio
+// heuristics still have to be applied to the results by the scanner.
+var sqlTemplates = map[string]string{
+	"dune": `-- txmsg-r candidate messages ({{.Range}})
+SELECT
+  block_number,
+  hash,
+  "from",
+  "to",
+  from_utf8(data) AS text
+FROM ethereum.transactions
+WHERE {{.BlockFilter}}
+  AND bytearray_length(data) > 0
+  AND (bytearray_length(data) < 4 OR bytearray_substring(data, 1, 4) NOT IN ({{.Selectors "0x%s"}}))
+  AND regexp_like(from_utf8(data), '{{.Pattern}}')
+ORDER BY block_number DESC
+`,
+	"bigquery": `-- txmsg-r candidate messages ({{.Range}})
+-- block_timestamp is the partition column; add a filter on it to bound the bytes scanned.
+SELECT
+  block_number,
+  ` + "`hash`" + `,
+  from_address,
+  to_address,
+  SAFE_CONVERT_BYTES_TO_STRING(FROM_HEX(SUBSTR(input, 3))) AS text
+FROM ` + "`bigquery-public-data.crypto_ethereum.transactions`" + `
+WHERE {{.BlockFilter}}
+  AND input != '0x'
+  AND (LENGTH(input) < 10 OR SUBSTR(input, 3, 8) NOT IN ({{.Selectors "'%s'"}}))
+  AND REGEXP_CONTAINS(SAFE_CONVERT_BYTES_TO_STRING(FROM_HEX(SUBSTR(input, 3))), r'{{.Pattern}}')
+ORDER BY block_number DESC
+`,
+}
+
+// sqlQuery is the data passed to a SQL template.
+type sqlQuery struct {
+	dialect    string
+	start, end int64
+	scanner    *txmsg.Scanner // The scanner whose pre-filters the query reproduces
+}
+
+// Range describes the block range in a comment-friendly form.
+func (q sqlQuery) Range() string {
+	if q.end == 0 {
+		return fmt.Sprintf("latest %d blocks", scanDepth)
+	}
+	return fmt.Sprintf("blocks %d-%d", q.start, q.end)
+}
+
+// BlockFilter restricts the query to the scan range. Without an explicit range
+// it mirrors the scanner's default of scanDepth blocks below the head.
+func (q sqlQuery) BlockFilter() string {
+	if q.end != 0 {
+		return fmt.Sprintf("block_number BETWEEN %d AND %d", q.start, q.end)
+	}
+	table := "ethereum.transactions"
+	if q.dialect == "bigquery" {
+		table = "`bigquery-public-data.crypto_ethereum.transactions`"
+	}
+	return fmt.Sprintf("block_number >= (SELECT MAX(block_number) FROM %s) - %d", table, scanDepth)
+}
+
+// Selectors lists the function selectors the scanner skips, with the
+// configuration's blocked and allowed selectors applied, each formatted with
+// format.
+func (q sqlQuery) Selectors(format string) string {
+	sigs := make([]string, 0, len(q.scanner.Selectors))
+	for sig := range q.scanner.Selectors {
+		sigs = append(sigs, fmt.Sprintf(format, sig))
+	}
+	sort.Strings(sigs)
+	return strings.Join(sigs, ", ")
+}
+
+// Pattern is the candidate message regex of the scanner's UTF-8 decoder,
+// which holds the configured minimum length.
+func (q sqlQuery) Pattern() string {
+	for _, d := range q.scanner.Decoders {
+		if u, ok := d.(*txmsg.UTF8Decoder); ok {
+			return u.String()
+		}
+	}
+	return txmsg.CandidateExpr(txmsg.DefaultMinLength)
+}
+
+// runSQL prints a Dune or BigQuery query equivalent to the scanner's filters,
+// so its findings can be cross-checked against warehouse data.
+func runSQL(args []string) {
+	fs := flag.NewFlagSet("sql", flag.ExitOnError)
+	dialect := fs.String("dialect", "dune", "SQL dialect: dune or bigquery")
+	start := fs.Int64("start", 0, "first block of the range (default: latest blocks)")
+	end := fs.Int64("end", 0, "last block of the range (default: latest blocks)")
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	text, ok := sqlTemplates[*dialect]
+	if !ok {
+		fatalf(exitUsage, "Unknown SQL dialect %q", *dialect)
+	}
+	if *end != 0 && *start > *end {
+		fatalf(exitUsage, "SQL range error: -start is after -end")
+	}
+
+	tmpl := template.Must(template.New(*dialect).Parse(text))
+	if err := tmpl.Execute(os.Stdout, sqlQuery{dialect: *dialect, start: *start, end: *end, scanner: chainOpts.scanner()}); err != nil {
+		fatalf(exitFailure, "SQL template error: %v", err)
+	}
+}
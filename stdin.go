@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// stdinRecord is an NDJSON input line of the stdin command. Metadata fields
+// use the names of the message fields they are copied to.
+type stdinRecord struct {
+	Data   string          `json:"data"` // Hex calldata, with or without 0x
+	TxHash common.Hash     `json:"txHash"`
+	Block  uint64          `json:"block"`
+	Time   uint64          `json:"time"`
+	From   common.Address  `json:"from"`
+	To     *common.Address `json:"to"`
+	Value  *big.Int        `json:"value"` // Wei, as a JSON number
+}
+
+// runStdin runs the detection pipeline over calldata read from standard input,
+// one payload per line: bare hex, or an NDJSON stdinRecord with metadata. The
+// messages are written to standard output as NDJSON, so the engine can sit in
+// other pipelines without the RPC layer. Lines that can't be parsed are logged
+// and skipped.
+func runStdin(args []string) {
+	fs := flag.NewFlagSet("stdin", flag.ExitOnError)
+	chainOpts := addChainFlags(fs, "mainnet")
+	parseFlags(fs, args)
+
+	scanner := chainOpts.scanner()
+	scanner.Provenance.Provider = "" // the calldata didn't come from the chain's endpoint
+	in := bufio.NewReader(os.Stdin)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+
+	for lineNum := 1; ; lineNum++ {
+		line, err := in.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			msgs, parseErr := scanLine(scanner, line)
+			if parseErr != nil {
+				log.Printf("Line %d error: %v", lineNum, parseErr)
+			}
+			for _, msg := range msgs {
+				if err := enc.Encode(msg); err != nil {
+					fatalf(exitFailure, "Output error: %v", err)
+				}
+			}
+			// Let downstream consumers see each payload's messages promptly.
+			if err := out.Flush(); err != nil {
+				fatalf(exitFailure, "Output error: %v", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			fatalf(exitFailure, "Input error: %v", err)
+		}
+	}
+}
+
+// scanLine parses an input line and returns its messages.
+func scanLine(scanner *txmsg.Scanner, line []byte) ([]txmsg.Message, error) {
+	line = bytes.TrimSpace(line)
+	var rec stdinRecord
+	if line[0] == '{' {
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, err
+		}
+	} else {
+		rec.Data = string(line)
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(rec.Data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("calldata: %w", err)
+	}
+	msgs := scanner.ScanCall(txmsg.Call{From: rec.From, To: rec.To, Value: rec.Value, Data: data})
+	for i := range msgs {
+		msgs[i].TxHash, msgs[i].Block, msgs[i].Time = rec.TxHash, rec.Block, rec.Time
+	}
+	return msgs, nil
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// ErrBuffered is returned (wrapped with the store's error) by Buffered.Save
+// when the messages could not be written to the store and went to the
+// pending file instead. No data was lost.
+var ErrBuffered = errors.New("store unavailable, messages buffered")
+
+// Buffered wraps a Store so that messages the store rejects are appended to a
+// local pending file (one JSON message per line) instead of being dropped. The
+// file is replayed into the store on the next Save and removed once the store
+// accepts writes again.
+type Buffered struct {
+	*Store
+	path string
+
+	mu      sync.Mutex
+	pending bool
+}
+
+// NewBuffered wraps st, buffering to the file at path. Messages left over in
+// the file from an earlier run are replayed on the first Save. With an empty
+// path, nothing is buffered and Save returns the store's errors.
+func NewBuffered(st *Store, path string) *Buffered {
+	info, err := os.Stat(path)
+	return &Buffered{Store: st, path: path, pending: err == nil && info.Size() > 0}
+}
+
+// Save replays any buffered messages and then saves msgs. If the store fails,
+// msgs are buffered and the returned error wraps ErrBuffered.
+func (b *Buffered) Save(ctx context.Context, msgs []txmsg.Message) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending {
+		if err := b.replay(ctx); err != nil {
+			return 0, b.buffer(msgs, err)
+		}
+	}
+	n, err := b.Store.Save(ctx, msgs)
+	if err != nil {
+		return 0, b.buffer(msgs, err)
+	}
+	return n, nil
+}
+
+// Delete removes msgs from the store and from the pending file, so that a
+// retracted message isn't replayed later.
+func (b *Buffered) Delete(ctx context.Context, msgs []txmsg.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending {
+		buffered, err := b.read()
+		if err != nil {
+			return err
+		}
+		drop := make(map[[2]string]bool, len(msgs))
+		for _, msg := range msgs {
+			drop[[2]string{msg.TxHash.Hex(), msg.Text}] = true
+		}
+		var keep []txmsg.Message
+		for _, msg := range buffered {
+			if !drop[[2]string{msg.TxHash.Hex(), msg.Text}] {
+				keep = append(keep, msg)
+			}
+		}
+		if err := b.write(keep); err != nil {
+			return err
+		}
+	}
+	return b.Store.Delete(ctx, msgs)
+}
+
+// buffer appends msgs to the pending file after the store failed with cause.
+func (b *Buffered) buffer(msgs []txmsg.Message, cause error) error {
+	if b.path == "" {
+		return cause
+	}
+	if len(msgs) > 0 {
+		f, err := os.OpenFile(b.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("%v; buffer: %w", cause, err)
+		}
+		enc := json.NewEncoder(f)
+		for _, msg := range msgs {
+			if err := enc.Encode(msg); err != nil {
+				f.Close()
+				return fmt.Errorf("%v; buffer: %w", cause, err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("%v; buffer: %w", cause, err)
+		}
+		b.pending = true
+	}
+	return fmt.Errorf("%w: %v", ErrBuffered, cause)
+}
+
+// replay saves the buffered messages to the store and removes the file.
+func (b *Buffered) replay(ctx context.Context) error {
+	msgs, err := b.read()
+	if err != nil {
+		return err
+	}
+	if _, err := b.Store.Save(ctx, msgs); err != nil {
+		return err
+	}
+	if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	b.pending = false
+	return nil
+}
+
+// read loads the buffered messages.
+func (b *Buffered) read() ([]txmsg.Message, error) {
+	f, err := os.Open(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []txmsg.Message
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var msg txmsg.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", b.path, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
+
+// write replaces the pending file with msgs, removing it if msgs is empty.
+func (b *Buffered) write(msgs []txmsg.Message) error {
+	if len(msgs) == 0 {
+		b.pending = false
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tmp := b.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
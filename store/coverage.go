@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// Range is a block range that has been scanned into the store, with the
+// scanner configuration and version that scanned it.
+type Range struct {
+	Start      uint64 `json:"start"`
+	End        uint64 `json:"end"` // Inclusive
+	ConfigHash string `json:"configHash,omitempty"`
+	Version    string `json:"version,omitempty"`
+}
+
+// AddCoverage records that blocks start to end were scanned by a scanner with
+// provenance p, which may be nil. It merges the range with overlapping and
+// adjacent ranges scanned with the same configuration and version, so that
+// following the chain block by block keeps a single row.
+func (s *Store) AddCoverage(ctx context.Context, start, end uint64, p *txmsg.Provenance) error {
+	var configHash, version string
+	if p != nil {
+		configHash, version = p.ConfigHash, p.Version
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lo, hi *uint64
+	err = tx.QueryRowContext(ctx, `SELECT MIN(start), MAX("end") FROM coverage
+		WHERE config_hash = ? AND version = ? AND start <= ? + 1 AND "end" + 1 >= ?`,
+		configHash, version, end, start).Scan(&lo, &hi)
+	if err != nil {
+		return err
+	}
+	if lo != nil {
+		start, end = min(start, *lo), max(end, *hi)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM coverage
+		WHERE config_hash = ? AND version = ? AND start >= ? AND "end" <= ?`,
+		configHash, version, start, end); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO coverage (start, "end", config_hash, version) VALUES (?, ?, ?, ?)`,
+		start, end, configHash, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Coverage returns the scanned ranges, ordered by start block. Ranges scanned
+// with different configurations may overlap.
+func (s *Store) Coverage(ctx context.Context) ([]Range, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT start, "end", config_hash, version FROM coverage ORDER BY start, "end"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ranges []Range
+	for rows.Next() {
+		var r Range
+		if err := rows.Scan(&r.Start, &r.End, &r.ConfigHash, &r.Version); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// Gaps returns the block ranges between the first and last scanned block that
+// no range covers.
+func Gaps(ranges []Range) []Range {
+	var gaps []Range
+	var next uint64 // first block not covered so far
+	for i, r := range ranges {
+		if i > 0 && r.Start > next {
+			gaps = append(gaps, Range{Start: next, End: r.Start - 1})
+		}
+		if i == 0 || r.End+1 > next {
+			next = r.End + 1
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// Feedback is a user's verdict on a stored message: good if it is a real
+// message, bad if it is a false positive.
+type Feedback struct {
+	TxHash common.Hash
+	Text   string
+	Good   bool
+}
+
+// SetFeedback records the verdict good on msgs, replacing earlier verdicts.
+func (s *Store) SetFeedback(ctx context.Context, msgs []txmsg.Message, good bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, msg := range msgs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO feedback (tx_hash, text, good) VALUES (?, ?, ?)
+			ON CONFLICT (tx_hash, text) DO UPDATE SET good = excluded.good`,
+			msg.TxHash.Hex(), msg.Text, good); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Feedback returns every recorded verdict.
+func (s *Store) Feedback(ctx context.Context) ([]Feedback, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tx_hash, text, good FROM feedback ORDER BY tx_hash, text`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fbs []Feedback
+	for rows.Next() {
+		var (
+			fb     Feedback
+			txHash string
+		)
+		if err := rows.Scan(&txHash, &fb.Text, &fb.Good); err != nil {
+			return nil, err
+		}
+		fb.TxHash = common.HexToHash(txHash)
+		fbs = append(fbs, fb)
+	}
+	return fbs, rows.Err()
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// migration brings the schema from the previous version to the next. Every
+// migration is idempotent, because databases created before schema versioning
+// start at version 0 with some of the later changes already applied.
+type migration struct {
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations are the schema changes in order; a database at version N has had
+// the first N applied. Only ever append to this list.
+var migrations = []migration{
+	{"create messages and checkpoint", execSQL(`
+CREATE TABLE IF NOT EXISTS messages (
+	tx_hash   TEXT    NOT NULL,
+	block     INTEGER NOT NULL,
+	time      INTEGER NOT NULL,
+	sender    TEXT    NOT NULL,
+	recipient TEXT,
+	value     TEXT    NOT NULL,
+	text      TEXT    NOT NULL,
+	decoder   TEXT    NOT NULL,
+	PRIMARY KEY (tx_hash, text)
+);
+CREATE INDEX IF NOT EXISTS messages_block ON messages (block);
+CREATE INDEX IF NOT EXISTS messages_sender ON messages (sender);
+CREATE INDEX IF NOT EXISTS messages_recipient ON messages (recipient);
+
+CREATE TABLE IF NOT EXISTS checkpoint (
+	id    INTEGER PRIMARY KEY CHECK (id = 1),
+	block INTEGER NOT NULL
+);`)},
+	{"index messages by time", execSQL(`CREATE INDEX IF NOT EXISTS messages_time ON messages (time);`)},
+	{"add message context", addColumns("messages", `TEXT NOT NULL DEFAULT ''`, "context_before", "context_after")},
+	{"add contacts and entities", addColumns("messages", `TEXT NOT NULL DEFAULT ''`, "contacts", "entities")},
+	{"create leases", execSQL(`
+CREATE TABLE IF NOT EXISTS leases (
+	name    TEXT    PRIMARY KEY,
+	holder  TEXT    NOT NULL,
+	expires INTEGER NOT NULL -- Unix milliseconds
+);`)},
+	{"add fingerprints", addFingerprints},
+	{"create reads", execSQL(`
+CREATE TABLE IF NOT EXISTS reads (
+	tx_hash TEXT NOT NULL,
+	text    TEXT NOT NULL,
+	PRIMARY KEY (tx_hash, text)
+);`)},
+	{"add provenance", addColumns("messages", `TEXT NOT NULL DEFAULT ''`, "provenance")},
+	{"create coverage", execSQL(`
+CREATE TABLE IF NOT EXISTS coverage (
+	start       INTEGER NOT NULL,
+	"end"       INTEGER NOT NULL,
+	config_hash TEXT    NOT NULL,
+	version     TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS coverage_start ON coverage (start);`)},
+	{"create feedback", execSQL(`
+CREATE TABLE IF NOT EXISTS feedback (
+	tx_hash TEXT    NOT NULL,
+	text    TEXT    NOT NULL,
+	good    INTEGER NOT NULL,
+	PRIMARY KEY (tx_hash, text)
+);`)},
+	{"add chain IDs", addColumns("messages", `INTEGER NOT NULL DEFAULT 0`, "chain_id")},
+}
+
+// latestVersion is the schema version of this binary.
+var latestVersion = len(migrations)
+
+// migrate brings the database at path up to latestVersion, one transaction per
+// migration. An existing database is first copied to path.v<version>.bak, so
+// that a failed upgrade can be rolled back by hand. It refuses databases
+// written by a newer binary.
+func migrate(db *sql.DB, path string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		id      INTEGER PRIMARY KEY CHECK (id = 1),
+		version INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_version: %w", err)
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > latestVersion {
+		return fmt.Errorf("database schema version %d is newer than this binary's (%d); upgrade txmsg-r", version, latestVersion)
+	}
+	if version == latestVersion {
+		return nil
+	}
+	if err := backup(db, path, version); err != nil {
+		return fmt.Errorf("back up before migrating: %w", err)
+	}
+
+	for ; version < latestVersion; version++ {
+		m := migrations[version]
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		err = m.up(tx)
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_version (id, version) VALUES (1, ?)
+				ON CONFLICT (id) DO UPDATE SET version = excluded.version`, version+1)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to version %d (%s): %w", version+1, m.description, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the database's schema version, 0 if it predates
+// versioning or is new.
+func schemaVersion(db *sql.DB) (int, error) {
+	// Read-only handles can't create the table in databases that predate it.
+	var tables, version int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).
+		Scan(&tables)
+	if err == nil && tables > 0 {
+		err = db.QueryRow(`SELECT version FROM schema_version WHERE id = 1`).Scan(&version)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	return version, nil
+}
+
+// backup copies a database holding messages to path.v<version>.bak, unless
+// that backup already exists from an earlier, interrupted upgrade. New
+// databases have nothing to back up.
+func backup(db *sql.DB, path string, version int) error {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages'`).
+		Scan(&tables); err != nil || tables == 0 {
+		return err
+	}
+	dest := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	_, err := db.Exec(`VACUUM INTO ?`, dest)
+	return err
+}
+
+// execSQL returns a migration running statements.
+func execSQL(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// addColumns returns a migration adding columns declared as decl to table.
+func addColumns(table, decl string, columns ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, col := range columns {
+			if err := addColumn(tx, table, col, decl); err != nil {
+				return fmt.Errorf("add column %s: %w", col, err)
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn adds a column to table unless it already has it.
+func addColumn(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	return err
+}
+
+// addFingerprints adds the fingerprint column, fingerprints the messages
+// already stored and indexes the four 16-bit bands of fingerprints.
+// Fingerprints at most txmsg.SameTextDistance bits apart share at least one
+// band, so the indexes find the candidates for the first writer of a text.
+func addFingerprints(tx *sql.Tx) error {
+	if err := addColumn(tx, "messages", "fingerprint", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT rowid, text FROM messages WHERE fingerprint = 0`)
+	if err != nil {
+		return err
+	}
+	fps := make(map[int64]txmsg.Fingerprint)
+	for rows.Next() {
+		var (
+			id   int64
+			text string
+		)
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		if fp := txmsg.FingerprintText(text); fp != 0 {
+			fps[id] = fp
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, fp := range fps {
+		if _, err := tx.Exec(`UPDATE messages SET fingerprint = ? WHERE rowid = ?`, int64(fp), id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+CREATE INDEX IF NOT EXISTS messages_fp0 ON messages (fingerprint & 65535);
+CREATE INDEX IF NOT EXISTS messages_fp1 ON messages ((fingerprint >> 16) & 65535);
+CREATE INDEX IF NOT EXISTS messages_fp2 ON messages ((fingerprint >> 32) & 65535);
+CREATE INDEX IF NOT EXISTS messages_fp3 ON messages ((fingerprint >> 48) & 65535);`)
+	return err
+}
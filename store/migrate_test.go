@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// baselineSchema is the schema of databases written before the schema was
+// versioned, when messages had no context, contacts or fingerprints.
+const baselineSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	tx_hash   TEXT    NOT NULL,
+	block     INTEGER NOT NULL,
+	time      INTEGER NOT NULL,
+	sender    TEXT    NOT NULL,
+	recipient TEXT,
+	value     TEXT    NOT NULL,
+	text      TEXT    NOT NULL,
+	decoder   TEXT    NOT NULL,
+	PRIMARY KEY (tx_hash, text)
+);
+CREATE INDEX IF NOT EXISTS messages_block ON messages (block);
+CREATE INDEX IF NOT EXISTS messages_sender ON messages (sender);
+CREATE INDEX IF NOT EXISTS messages_recipient ON messages (recipient);
+
+CREATE TABLE IF NOT EXISTS checkpoint (
+	id    INTEGER PRIMARY KEY CHECK (id = 1),
+	block INTEGER NOT NULL
+);
+INSERT INTO checkpoint (id, block) VALUES (1, 120);
+INSERT INTO messages VALUES
+	('0x01', 100, 1700000000, '0xaaaa000000000000000000000000000000000000', '0xbbbb000000000000000000000000000000000000', '0', 'please return my funds', 'utf8'),
+	('0x02', 110, 1700000120, '0xcccc000000000000000000000000000000000000', NULL, '5', 'Please return my funds!', 'utf8');
+`
+
+// unversionedSchema is the baseline with the changes that were applied
+// ad hoc before schema versioning, as late databases without a version have it.
+const unversionedSchema = baselineSchema + `
+CREATE INDEX IF NOT EXISTS messages_time ON messages (time);
+ALTER TABLE messages ADD COLUMN context_before TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN context_after TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN contacts TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN entities TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN fingerprint INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS leases (
+	name    TEXT    PRIMARY KEY,
+	holder  TEXT    NOT NULL,
+	expires INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS reads (
+	tx_hash TEXT NOT NULL,
+	text    TEXT NOT NULL,
+	PRIMARY KEY (tx_hash, text)
+);
+`
+
+// createDB writes a database at path with schema, bypassing migrations.
+func createDB(t *testing.T, path, schema string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	for name, schema := range map[string]string{
+		"baseline":    baselineSchema,
+		"unversioned": unversionedSchema,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "txmsg.db")
+			createDB(t, path, schema)
+
+			st, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, err := schemaVersion(st.db); err != nil || v != latestVersion {
+				t.Errorf("schema version = %d, %v; want %d", v, err, latestVersion)
+			}
+			if _, err := os.Stat(path + ".v0.bak"); err != nil {
+				t.Errorf("no backup: %v", err)
+			}
+
+			block, ok, err := st.Checkpoint(ctx)
+			if err != nil || !ok || block != 120 {
+				t.Errorf("checkpoint = %d, %v, %v; want 120", block, ok, err)
+			}
+			msgs, err := st.Query(ctx, Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 2 {
+				t.Fatalf("%d messages after migrating, want 2", len(msgs))
+			}
+			for _, msg := range msgs {
+				if want := txmsg.FingerprintText(msg.Text); msg.Fingerprint != want {
+					t.Errorf("%q has fingerprint %s, want %s", msg.Text, msg.Fingerprint, want)
+				}
+			}
+			if msgs[1].To != nil {
+				t.Errorf("contract creation has recipient %s", msgs[1].To.Hex())
+			}
+
+			// The new tables work and the old rows attribute to the first writer.
+			w, err := st.FirstWriter(ctx, msgs[1].Fingerprint)
+			if err != nil || w == nil || w.TxHash != msgs[0].TxHash || w.Copies != 1 {
+				t.Errorf("FirstWriter = %+v, %v; want %s with 1 copy", w, err, msgs[0].TxHash.Hex())
+			}
+			if err := st.MarkRead(ctx, msgs[:1]); err != nil {
+				t.Error(err)
+			}
+			if err := st.AddCoverage(ctx, 100, 120, nil); err != nil {
+				t.Error(err)
+			}
+			if err := st.SetFeedback(ctx, msgs[:1], true); err != nil {
+				t.Error(err)
+			}
+			st.Close()
+
+			// Opening again is a no-op.
+			st, err = Open(path)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer st.Close()
+			if msgs, err := st.Query(ctx, Query{}); err != nil || len(msgs) != 2 {
+				t.Errorf("reopen: %d messages, %v", len(msgs), err)
+			}
+		})
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "txmsg.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.db.Exec(`UPDATE schema_version SET version = version + 1`); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Open of a newer schema = %v, want an error", err)
+	}
+}
+
+func TestNewDatabaseHasNoBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "txmsg.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+	if matches, _ := filepath.Glob(path + ".v*.bak"); len(matches) > 0 {
+		t.Errorf("new database backed up to %v", matches)
+	}
+}
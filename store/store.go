@@ -0,0 +1,511 @@
+// Package store persists discovered messages and scan progress in SQLite.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/txmsg"
+	_ "modernc.org/sqlite"
+)
+
+// Store is a SQLite database of messages. Addresses are stored lowercase so
+// that lookups don't depend on checksum casing.
+type Store struct {
+	db *sql.DB
+}
+
+// Query selects stored messages. Zero fields don't filter.
+type Query struct {
+	Keyword    string           // Case-insensitive substring of the message text
+	Address    *common.Address  // Sender or recipient
+	Recipients []common.Address // Any of these recipients
+	TxHash     *common.Hash
+	FromBlock  uint64
+	ToBlock    uint64
+	FromTime   uint64 // Block timestamps, in Unix seconds
+	ToTime     uint64
+	Unread     bool // Only messages not marked with MarkRead
+	Limit      int
+}
+
+// Open opens (creating if needed) the database at path.
+func Open(path string) (*Store, error) {
+	// Wait out other processes' writes, e.g. a standby watcher renewing its lease.
+	uri, err := fileURI(path, "_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", uri)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked".
+	db.SetMaxOpenConns(1)
+	if err := migrate(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenMemory opens a new, empty database held in memory, which is discarded
+// on Close. It behaves like a database opened with Open but writes no files.
+func OpenMemory() (*Store, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: is a separate database, so keep exactly one.
+	db.SetMaxOpenConns(1)
+	if err := migrate(db, ""); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenReadOnly opens the existing database at path for queries only. It
+// neither creates nor migrates the schema, and doesn't take SQLite's write
+// lock, so any number of readers can run next to the process writing it. The
+// database must be at the schema version of this binary.
+func OpenReadOnly(path string) (*Store, error) {
+	uri, err := fileURI(path, "mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", uri)
+	if err != nil {
+		return nil, err
+	}
+	version, err := schemaVersion(db)
+	if err == nil && version != latestVersion {
+		err = fmt.Errorf("database schema version %d, expected %d; open it read-write once to migrate it", version, latestVersion)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// fileURI returns the SQLite URI of the database at path with the given query
+// parameters. The path is made absolute, since a relative one would read as the
+// URI's host, and characters URIs give a meaning, such as ? and #, are escaped.
+func fileURI(path, query string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.ToSlash(abs)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // file:///C:/... on Windows
+	}
+	u := url.URL{Scheme: "file", Path: p, RawQuery: query}
+	return u.String(), nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save records msgs, skipping any already stored, and returns how many were new.
+func (s *Store) Save(ctx context.Context, msgs []txmsg.Message) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO messages
+		(tx_hash, block, time, sender, recipient, value, text, decoder, context_before, context_after, contacts,
+		entities, fingerprint, provenance, chain_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, msg := range msgs {
+		var recipient sql.NullString
+		if msg.To != nil {
+			recipient = sql.NullString{String: addressKey(*msg.To), Valid: true}
+		}
+		value := "0"
+		if msg.Value != nil {
+			value = msg.Value.String()
+		}
+		contacts, err := encodeJSON(msg.Contacts)
+		if err != nil {
+			return 0, err
+		}
+		entities, err := encodeJSON(msg.Entities)
+		if err != nil {
+			return 0, err
+		}
+		provenance, err := encodeJSON(msg.Provenance)
+		if err != nil {
+			return 0, err
+		}
+		fp := msg.Fingerprint
+		if fp == 0 {
+			fp = txmsg.FingerprintText(msg.Text)
+		}
+		res, err := stmt.ExecContext(ctx, msg.TxHash.Hex(), msg.Block, msg.Time,
+			addressKey(msg.From), recipient, value, msg.Text, msg.Decoder, msg.Before, msg.After, contacts, entities,
+			int64(fp), provenance, msg.ChainID)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += int(n)
+	}
+	return added, tx.Commit()
+}
+
+// Delete removes msgs, e.g. when their block was reorged out.
+func (s *Store) Delete(ctx context.Context, msgs []txmsg.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, msg := range msgs {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE tx_hash = ? AND text = ?`,
+			msg.TxHash.Hex(), msg.Text); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkRead records msgs as read, so that Query with Unread skips them.
+func (s *Store) MarkRead(ctx context.Context, msgs []txmsg.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, msg := range msgs {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO reads (tx_hash, text) VALUES (?, ?)`,
+			msg.TxHash.Hex(), msg.Text); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Checkpoint returns the last block recorded with SetCheckpoint. ok is false if
+// nothing has been scanned yet.
+func (s *Store) Checkpoint(ctx context.Context) (block uint64, ok bool, err error) {
+	err = s.db.QueryRowContext(ctx, `SELECT block FROM checkpoint WHERE id = 1`).Scan(&block)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return block, err == nil, err
+}
+
+// SetCheckpoint records block as the last block scanned.
+func (s *Store) SetCheckpoint(ctx context.Context, block uint64) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO checkpoint (id, block) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET block = excluded.block`, block)
+	return err
+}
+
+// AcquireLease takes or renews the lease called name for holder until ttl
+// from now, and reports whether holder has it. A lease can only be taken from
+// another holder once it has expired. It is how instances sharing a store
+// elect the one that writes.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO leases (name, holder, expires) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE leases.holder = excluded.holder OR leases.expires < ?`,
+		name, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Query returns the messages matching q, ordered by block and tx hash.
+func (s *Store) Query(ctx context.Context, q Query) ([]txmsg.Message, error) {
+	var where []string
+	var args []any
+	if q.Keyword != "" {
+		where = append(where, `text LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.Keyword)+"%")
+	}
+	if q.Address != nil {
+		where = append(where, `(sender = ? OR recipient = ?)`)
+		args = append(args, addressKey(*q.Address), addressKey(*q.Address))
+	}
+	if len(q.Recipients) > 0 {
+		where = append(where, `recipient IN (?`+strings.Repeat(`, ?`, len(q.Recipients)-1)+`)`)
+		for _, addr := range q.Recipients {
+			args = append(args, addressKey(addr))
+		}
+	}
+	if q.TxHash != nil {
+		where = append(where, `tx_hash = ?`)
+		args = append(args, q.TxHash.Hex())
+	}
+	if q.FromBlock != 0 {
+		where = append(where, `block >= ?`)
+		args = append(args, q.FromBlock)
+	}
+	if q.ToBlock != 0 {
+		where = append(where, `block <= ?`)
+		args = append(args, q.ToBlock)
+	}
+	if q.FromTime != 0 {
+		where = append(where, `time >= ?`)
+		args = append(args, q.FromTime)
+	}
+	if q.ToTime != 0 {
+		where = append(where, `time <= ?`)
+		args = append(args, q.ToTime)
+	}
+
+	if q.Unread {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM reads r WHERE r.tx_hash = messages.tx_hash AND r.text = messages.text)`)
+	}
+
+	query := `SELECT tx_hash, block, time, sender, recipient, value, text, decoder, context_before, context_after,
+		contacts, entities, fingerprint, provenance, chain_id FROM messages`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY block, tx_hash"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []txmsg.Message
+	for rows.Next() {
+		var (
+			msg                   txmsg.Message
+			txHash, sender, value string
+			recipient             sql.NullString
+			contacts, entities    string
+			fingerprint           int64
+			provenance            string
+		)
+		if err := rows.Scan(&txHash, &msg.Block, &msg.Time, &sender, &recipient, &value, &msg.Text, &msg.Decoder,
+			&msg.Before, &msg.After, &contacts, &entities, &fingerprint, &provenance, &msg.ChainID); err != nil {
+			return nil, err
+		}
+		if contacts != "" {
+			msg.Contacts = new(txmsg.Contacts)
+			if err := json.Unmarshal([]byte(contacts), msg.Contacts); err != nil {
+				return nil, fmt.Errorf("tx %s contacts: %w", txHash, err)
+			}
+		}
+		if entities != "" {
+			if err := json.Unmarshal([]byte(entities), &msg.Entities); err != nil {
+				return nil, fmt.Errorf("tx %s entities: %w", txHash, err)
+			}
+		}
+		if provenance != "" {
+			msg.Provenance = new(txmsg.Provenance)
+			if err := json.Unmarshal([]byte(provenance), msg.Provenance); err != nil {
+				return nil, fmt.Errorf("tx %s provenance: %w", txHash, err)
+			}
+		}
+		msg.Fingerprint = txmsg.Fingerprint(fingerprint)
+		msg.TxHash = common.HexToHash(txHash)
+		msg.From = common.HexToAddress(sender)
+		if recipient.Valid {
+			to := common.HexToAddress(recipient.String)
+			msg.To = &to
+		}
+		msg.Value, _ = new(big.Int).SetString(value, 10)
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// FirstSeen returns the earliest block timestamp at which text was stored. ok
+// is false if it never was.
+func (s *Store) FirstSeen(ctx context.Context, text string) (t uint64, ok bool, err error) {
+	var first sql.NullInt64
+	err = s.db.QueryRowContext(ctx, `SELECT MIN(time) FROM messages WHERE text = ?`, text).Scan(&first)
+	return uint64(first.Int64), first.Valid, err
+}
+
+// FirstWriter returns the earliest stored message with the same text as fp,
+// allowing for small edits, and how many other transactions republished it.
+// It returns nil if no stored message has that text.
+func (s *Store) FirstWriter(ctx context.Context, fp txmsg.Fingerprint) (*txmsg.Attribution, error) {
+	writers, err := s.firstWriters(ctx, []txmsg.Fingerprint{fp})
+	return writers[fp], err
+}
+
+// Attribute sets FirstWriter on each of msgs, looking up the texts of up to
+// attributeBatch messages per query. Copies stored in others, such as the
+// databases of other chains, are counted too, and the earliest copy in any of
+// the stores is the first writer.
+func (s *Store) Attribute(ctx context.Context, msgs []txmsg.Message, others ...*Store) error {
+	var fps []txmsg.Fingerprint
+	seen := make(map[txmsg.Fingerprint]bool)
+	for _, msg := range msgs {
+		if msg.Fingerprint != 0 && !seen[msg.Fingerprint] {
+			seen[msg.Fingerprint] = true
+			fps = append(fps, msg.Fingerprint)
+		}
+	}
+	writers := make(map[txmsg.Fingerprint]*txmsg.Attribution, len(fps))
+	for _, st := range append([]*Store{s}, others...) {
+		for batch := range slices.Chunk(fps, attributeBatch) {
+			found, err := st.firstWriters(ctx, batch)
+			if err != nil {
+				return err
+			}
+			mergeWriters(writers, found)
+		}
+	}
+	for i := range msgs {
+		msgs[i].FirstWriter = writers[msgs[i].Fingerprint]
+	}
+	return nil
+}
+
+// mergeWriters adds the first writers found in another store to writers,
+// keeping the earlier of two and counting the copies of both.
+func mergeWriters(writers, found map[txmsg.Fingerprint]*txmsg.Attribution) {
+	for fp, w := range found {
+		cur, ok := writers[fp]
+		if !ok {
+			writers[fp] = w
+			continue
+		}
+		copies := cur.Copies + w.Copies + 1
+		if w.Time < cur.Time || w.Time == cur.Time && w.Block < cur.Block {
+			cur = w
+			writers[fp] = w
+		}
+		cur.Copies = copies
+	}
+}
+
+// attributeBatch is how many fingerprints one first-writer query looks up,
+// each taking a parameter per band.
+const attributeBatch = 250
+
+// fingerprintBands are the expressions of the four 16-bit bands of the
+// fingerprint column, as indexed. Fingerprints at most
+// txmsg.SameTextDistance bits apart share at least one band.
+var fingerprintBands = [4]string{
+	`fingerprint & 65535`,
+	`(fingerprint >> 16) & 65535`,
+	`(fingerprint >> 32) & 65535`,
+	`(fingerprint >> 48) & 65535`,
+}
+
+// firstWriters returns the first writer of each of fps that has one, reading
+// every stored message that shares a band with any of them in one query.
+func (s *Store) firstWriters(ctx context.Context, fps []txmsg.Fingerprint) (map[txmsg.Fingerprint]*txmsg.Attribution, error) {
+	// For each band, the fingerprints looked up by its value.
+	var bands [len(fingerprintBands)]map[uint64][]txmsg.Fingerprint
+	for b := range bands {
+		bands[b] = make(map[uint64][]txmsg.Fingerprint)
+	}
+	for _, fp := range fps {
+		if fp == 0 {
+			continue
+		}
+		for b := range bands {
+			v := uint64(fp) >> (16 * b) & 0xffff
+			bands[b][v] = append(bands[b][v], fp)
+		}
+	}
+	writers := make(map[txmsg.Fingerprint]*txmsg.Attribution)
+	if len(bands[0]) == 0 {
+		return writers, nil
+	}
+
+	var where []string
+	var args []any
+	for b, values := range bands {
+		where = append(where, fingerprintBands[b]+` IN (?`+strings.Repeat(`, ?`, len(values)-1)+`)`)
+		for v := range values {
+			args = append(args, v)
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT tx_hash, chain_id, block, time, sender, fingerprint FROM messages
+		WHERE `+strings.Join(where, " OR ")+` ORDER BY time, block, tx_hash`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := make(map[txmsg.Fingerprint]map[string]bool)
+	for rows.Next() {
+		var (
+			txHash, sender    string
+			chainID, block, t uint64
+			other             int64
+		)
+		if err := rows.Scan(&txHash, &chainID, &block, &t, &sender, &other); err != nil {
+			return nil, err
+		}
+		for b := range bands {
+			for _, fp := range bands[b][uint64(other)>>(16*b)&0xffff] {
+				if !fp.SameText(txmsg.Fingerprint(other)) || txs[fp][txHash] {
+					continue
+				}
+				if txs[fp] == nil {
+					txs[fp] = make(map[string]bool)
+					writers[fp] = &txmsg.Attribution{TxHash: common.HexToHash(txHash), ChainID: chainID, Block: block,
+						Time: t, From: common.HexToAddress(sender)}
+				}
+				txs[fp][txHash] = true
+			}
+		}
+	}
+	for fp, w := range writers {
+		w.Copies = len(txs[fp]) - 1
+	}
+	return writers, rows.Err()
+}
+
+// encodeJSON returns the stored form of an optional message field: JSON, or
+// "" if v is nil.
+func encodeJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// addressKey is the stored form of an address.
+func addressKey(addr common.Address) string {
+	return strings.ToLower(addr.Hex())
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
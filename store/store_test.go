@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+func TestOpenReadOnlyEscapesPath(t *testing.T) {
+	ctx := context.Background()
+	for _, name := range []string{"plain.db", "we?ird#name.db", "100%.db"} {
+		path := filepath.Join(t.TempDir(), name)
+		st, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", name, err)
+		}
+		if err := st.SetCheckpoint(ctx, 42); err != nil {
+			t.Fatal(err)
+		}
+		st.Close()
+		if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*")); len(matches) != 1 || matches[0] != path {
+			t.Errorf("Open(%q) wrote %v", name, matches)
+		}
+
+		ro, err := OpenReadOnly(path)
+		if err != nil {
+			t.Fatalf("OpenReadOnly(%q): %v", name, err)
+		}
+		block, ok, err := ro.Checkpoint(ctx)
+		if err != nil || !ok || block != 42 {
+			t.Errorf("OpenReadOnly(%q) checkpoint = %d, %v, %v; want 42", name, block, ok, err)
+		}
+		if err := ro.SetCheckpoint(ctx, 43); err == nil {
+			t.Errorf("OpenReadOnly(%q) allowed a write", name)
+		}
+		ro.Close()
+	}
+}
+
+func TestSaveChainID(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	msgs := []txmsg.Message{
+		{TxHash: common.HexToHash("0x01"), ChainID: 1, Time: 10, Text: "hello from mainnet", Decoder: "utf8"},
+		{TxHash: common.HexToHash("0x02"), ChainID: 8453, Time: 20, Text: "hello from mainnet!", Decoder: "utf8"},
+	}
+	if _, err := st.Save(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := st.Query(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ChainID != 1 || got[1].ChainID != 8453 {
+		t.Fatalf("Query returned %+v", got)
+	}
+	// A copy on another chain is attributed to the chain of the first writer.
+	w, err := st.FirstWriter(ctx, got[1].Fingerprint)
+	if err != nil || w == nil || w.TxHash != msgs[0].TxHash || w.ChainID != 1 || w.Copies != 1 {
+		t.Errorf("FirstWriter = %+v, %v; want tx 0x01 on chain 1 with 1 copy", w, err)
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	// More texts than one batch looks up, each written once and copied later
+	// with an edit, plus a text that was never copied.
+	rng := rand.New(rand.NewSource(1))
+	var msgs []txmsg.Message
+	want := make(map[common.Hash]common.Hash) // First writer of each tx's text
+	for i := range attributeBatch + 10 {
+		text := randomText(rng, 10)
+		first, copied := testMessage(100+i, text), testMessage(1000+i, text+"!!")
+		msgs = append(msgs, first, copied)
+		want[first.TxHash], want[copied.TxHash] = first.TxHash, first.TxHash
+	}
+	lone := testMessage(5000, "a completely different note that nobody repeated")
+	msgs = append(msgs, lone)
+	want[lone.TxHash] = lone.TxHash
+	if _, err := st.Save(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := st.Query(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Attribute(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range got {
+		copies := 1
+		if msg.TxHash == lone.TxHash {
+			copies = 0
+		}
+		w := msg.FirstWriter
+		if w == nil || w.TxHash != want[msg.TxHash] || w.Copies != copies {
+			t.Errorf("%s: first writer %+v, want %s with %d copies", msg.TxHash.Hex(), w, want[msg.TxHash].Hex(), copies)
+			continue
+		}
+		if single, err := st.FirstWriter(ctx, msg.Fingerprint); err != nil || single == nil || *single != *w {
+			t.Errorf("%s: FirstWriter = %+v, %v; Attribute set %+v", msg.TxHash.Hex(), single, err, w)
+		}
+	}
+}
+
+func TestAttributeAcrossStores(t *testing.T) {
+	ctx := context.Background()
+	open := func(msgs ...txmsg.Message) *Store {
+		st, err := OpenMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+		if _, err := st.Save(ctx, msgs); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	text := "the same note posted on every chain we could find"
+	mainnet := testMessage(300, text)
+	mainnet.ChainID = 1
+	base, baseCopy := testMessage(100, text+"!"), testMessage(200, text)
+	base.ChainID, baseCopy.ChainID = 8453, 8453
+	optimism := testMessage(400, "an unrelated note on yet another chain")
+	optimism.ChainID = 10
+
+	st := open(mainnet)
+	got, err := st.Query(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Attribute(ctx, got, open(base, baseCopy), open(optimism)); err != nil {
+		t.Fatal(err)
+	}
+	w := got[0].FirstWriter
+	if w == nil || w.TxHash != base.TxHash || w.ChainID != 8453 || w.Copies != 2 {
+		t.Errorf("first writer %+v, want %s on chain 8453 with 2 copies", w, base.TxHash.Hex())
+	}
+}
+
+// randomText returns a number of made-up words.
+func randomText(rng *rand.Rand, words int) string {
+	var b strings.Builder
+	for range words {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		for range 3 + rng.Intn(5) {
+			b.WriteByte(byte('a' + rng.Intn(26)))
+		}
+	}
+	return b.String()
+}
+
+// testMessage returns a message with text in a transaction of its own at block.
+func testMessage(block int, text string) txmsg.Message {
+	return txmsg.Message{TxHash: common.BigToHash(big.NewInt(int64(block))), Block: uint64(block),
+		Time: uint64(block) * 12, Text: text, Decoder: "utf8", Fingerprint: txmsg.FingerprintText(text)}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// timestampAnomaly returns a description of what is odd about a block
+// timestamp, or "" if it looks sane. A timestamp is odd if it is further than
+// maxSkew ahead of the local clock, or earlier than its parent's (parentTime is
+// zero when the parent isn't known). Anomalies are only reported; the block is
+// still scanned.
+func timestampAnomaly(blockTime, parentTime uint64, now time.Time, maxSkew time.Duration) string {
+	if blockTime > uint64(now.Unix()) {
+		ahead := time.Duration(blockTime-uint64(now.Unix())) * time.Second
+		if ahead > maxSkew {
+			return fmt.Sprintf("timestamp %s ahead of local clock", ahead)
+		}
+	}
+	if parentTime != 0 && blockTime < parentTime {
+		behind := time.Duration(parentTime-blockTime) * time.Second
+		return fmt.Sprintf("timestamp %s earlier than parent", behind)
+	}
+	return ""
+}
+
+// formatBlockTime formats a block timestamp. Values outside the range of
+// time.Time, which only a misbehaving chain produces, are printed raw.
+func formatBlockTime(blockTime uint64) string {
+	if blockTime > math.MaxInt64/2 {
+		return fmt.Sprintf("timestamp %d", blockTime)
+	}
+	return time.Unix(int64(blockTime), 0).UTC().Format(timestampForm)
+}
@@ -0,0 +1,119 @@
+package txmsg
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// abiWord is the size of an ABI-encoded word.
+const abiWord = 32
+
+// selectorOf returns the hex function selector of calldata, or "" if data is
+// too short to have one.
+func selectorOf(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	return hex.EncodeToString(data[:4])
+}
+
+// abiArgs returns the arguments of calldata with the given hex selector, or
+// false if data calls another function.
+func abiArgs(data []byte, selector string) ([]byte, bool) {
+	if selectorOf(data) != selector {
+		return nil, false
+	}
+	return data[4:], true
+}
+
+// abiUint reads the i-th word of args as an integer that fits in an int, or
+// returns false.
+func abiUint(args []byte, i int) (int, bool) {
+	v, ok := abiInt(args, i)
+	if !ok || !v.IsInt64() || v.Int64() > int64(len(args)) {
+		return 0, false // no offset or length can point past the payload
+	}
+	return int(v.Int64()), true
+}
+
+// abiInt reads the i-th word of args as an unsigned integer, or returns false.
+func abiInt(args []byte, i int) (*big.Int, bool) {
+	start := i * abiWord
+	if start < 0 || start+abiWord > len(args) {
+		return nil, false
+	}
+	return new(big.Int).SetBytes(args[start : start+abiWord]), true
+}
+
+// abiAddress reads the i-th word of args as an address, or returns false.
+func abiAddress(args []byte, i int) (common.Address, bool) {
+	start := i * abiWord
+	if start < 0 || start+abiWord > len(args) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(args[start+12 : start+abiWord]), true
+}
+
+// abiBytes reads the dynamic bytes or string argument whose offset is in the
+// i-th word of args.
+func abiBytes(args []byte, i int) ([]byte, bool) {
+	offset, ok := abiUint(args, i)
+	if !ok {
+		return nil, false
+	}
+	return abiBytesAt(args, offset)
+}
+
+// abiBytesAt reads the length-prefixed bytes starting at offset in args.
+func abiBytesAt(args []byte, offset int) ([]byte, bool) {
+	if offset%abiWord != 0 {
+		return nil, false
+	}
+	n, ok := abiUint(args, offset/abiWord)
+	if !ok || offset+abiWord+n > len(args) {
+		return nil, false
+	}
+	start := offset + abiWord
+	return args[start : start+n], true
+}
+
+// abiDynamicArray reads the array of dynamic elements (tuples with dynamic
+// fields, or bytes) whose offset is in the i-th word of args. Each element is
+// returned as the rest of the payload from the element's start, so its fields
+// can be read with offsets relative to it.
+func abiDynamicArray(args []byte, i int) ([][]byte, bool) {
+	offset, ok := abiUint(args, i)
+	if !ok || offset%abiWord != 0 {
+		return nil, false
+	}
+	n, ok := abiUint(args, offset/abiWord)
+	if !ok {
+		return nil, false
+	}
+	base := args[min(offset+abiWord, len(args)):]
+	elems := make([][]byte, 0, n)
+	for j := range n {
+		rel, ok := abiUint(base, j)
+		if !ok || rel%abiWord != 0 {
+			return nil, false
+		}
+		elems = append(elems, base[rel:])
+	}
+	return elems, true
+}
+
+// abiStaticArrayEnd returns the end of the array of one-word elements whose
+// offset is in the i-th word of args.
+func abiStaticArrayEnd(args []byte, i int) (int, bool) {
+	offset, ok := abiUint(args, i)
+	if !ok || offset%abiWord != 0 {
+		return 0, false
+	}
+	n, ok := abiUint(args, offset/abiWord)
+	if !ok || offset+abiWord+n*abiWord > len(args) {
+		return 0, false
+	}
+	return offset + abiWord + n*abiWord, true
+}
@@ -0,0 +1,169 @@
+package txmsg
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Multicall entry points. The Multicall/Multicall2/Multicall3 aggregators call
+// other contracts; multicall(bytes[]) (Uniswap routers, ENS resolvers and many
+// others) delegatecalls the contract itself.
+const (
+	aggregateSelector            = "252dba42" // aggregate((address,bytes)[])
+	blockAndAggregateSelector    = "c3077fa9" // blockAndAggregate((address,bytes)[])
+	tryAggregateSelector         = "bce38bd7" // tryAggregate(bool,(address,bytes)[])
+	tryBlockAndAggregateSelector = "399542e9" // tryBlockAndAggregate(bool,(address,bytes)[])
+	aggregate3Selector           = "82ad56cb" // aggregate3((address,bool,bytes)[])
+	aggregate3ValueSelector      = "174dea71" // aggregate3Value((address,bool,uint256,bytes)[])
+	multicallSelector            = "ac9650d8" // multicall(bytes[])
+	multicallDeadlineSelector    = "5ae401dc" // multicall(uint256,bytes[])
+)
+
+// multiSend(bytes transactions), Safe's MultiSend and MultiSendCallOnly.
+const multiSendSelector = "8d80ff0a"
+
+// Disperse.app entry points. They take only addresses and amounts, so the
+// only place for a message is data appended after the arguments.
+const (
+	disperseEtherSelector       = "e63d38ed" // disperseEther(address[],uint256[])
+	disperseTokenSelector       = "c73a2d60" // disperseToken(address,address[],uint256[])
+	disperseTokenSimpleSelector = "51ba162c" // disperseTokenSimple(address,address[],uint256[])
+)
+
+// MulticallUnwrapper opens up Multicall aggregator and multicall(bytes[])
+// batches. Each sub-call is attributed to its target; aggregator sub-calls are
+// made by the aggregator, self-multicall sub-calls by the original sender.
+type MulticallUnwrapper struct{}
+
+// Name implements Unwrapper.
+func (MulticallUnwrapper) Name() string { return "multicall" }
+
+// Unwrap implements Unwrapper.
+func (MulticallUnwrapper) Unwrap(to common.Address, data []byte) []Call {
+	// Word index of the calls array and, within each tuple, of the target,
+	// value (-1 for none) and calldata.
+	var array, value, callData int
+	switch selectorOf(data) {
+	case aggregateSelector, blockAndAggregateSelector:
+		array, value, callData = 0, -1, 1
+	case tryAggregateSelector, tryBlockAndAggregateSelector:
+		array, value, callData = 1, -1, 1
+	case aggregate3Selector:
+		array, value, callData = 0, -1, 2
+	case aggregate3ValueSelector:
+		array, value, callData = 0, 2, 3
+	case multicallSelector:
+		return selfCalls(to, data[4:], 0)
+	case multicallDeadlineSelector:
+		return selfCalls(to, data[4:], 1)
+	default:
+		return nil
+	}
+
+	elems, ok := abiDynamicArray(data[4:], array)
+	if !ok {
+		return nil
+	}
+	calls := make([]Call, 0, len(elems))
+	for _, e := range elems {
+		target, ok1 := abiAddress(e, 0)
+		inner, ok2 := abiBytes(e, callData)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		c := Call{From: to, To: &target, Value: new(big.Int), Data: inner}
+		if value >= 0 {
+			if c.Value, ok = abiInt(e, value); !ok {
+				return nil
+			}
+		}
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// selfCalls reads the bytes[] in the i-th word of args as calls the contract at
+// to makes to itself on behalf of the sender.
+func selfCalls(to common.Address, args []byte, i int) []Call {
+	elems, ok := abiDynamicArray(args, i)
+	if !ok {
+		return nil
+	}
+	calls := make([]Call, 0, len(elems))
+	for _, e := range elems {
+		inner, ok := abiBytesAt(e, 0)
+		if !ok {
+			return nil
+		}
+		calls = append(calls, Call{To: &to, Data: inner})
+	}
+	return calls
+}
+
+// MultiSendUnwrapper opens up Safe MultiSend batches. MultiSend runs by
+// delegatecall from a Safe, so the sub-calls are made by the Safe itself.
+type MultiSendUnwrapper struct{}
+
+// Name implements Unwrapper.
+func (MultiSendUnwrapper) Name() string { return "multisend" }
+
+// Unwrap implements Unwrapper. The transactions are packed back to back as
+// operation (1 byte), to (20), value (32), data length (32) and data.
+func (MultiSendUnwrapper) Unwrap(_ common.Address, data []byte) []Call {
+	args, ok := abiArgs(data, multiSendSelector)
+	if !ok {
+		return nil
+	}
+	packed, ok := abiBytes(args, 0)
+	if !ok {
+		return nil
+	}
+	calls := []Call{}
+	for len(packed) > 0 {
+		const header = 1 + common.AddressLength + 32 + 32
+		if len(packed) < header {
+			return nil
+		}
+		to := common.BytesToAddress(packed[1:21])
+		value := new(big.Int).SetBytes(packed[21:53])
+		size := new(big.Int).SetBytes(packed[53:85])
+		if !size.IsUint64() || size.Uint64() > uint64(len(packed)-header) {
+			return nil
+		}
+		end := header + int(size.Uint64())
+		calls = append(calls, Call{To: &to, Value: value, Data: packed[header:end]})
+		packed = packed[end:]
+	}
+	return calls
+}
+
+// DisperseUnwrapper scans data appended after the arguments of Disperse.app
+// batch transfers, which would otherwise be skipped as an ordinary contract
+// call. The appended data is attributed to the sender.
+type DisperseUnwrapper struct{}
+
+// Name implements Unwrapper.
+func (DisperseUnwrapper) Name() string { return "disperse" }
+
+// Unwrap implements Unwrapper.
+func (DisperseUnwrapper) Unwrap(_ common.Address, data []byte) []Call {
+	var first int // word index of the recipients array; amounts follow it
+	switch selectorOf(data) {
+	case disperseEtherSelector:
+		first = 0
+	case disperseTokenSelector, disperseTokenSimpleSelector:
+		first = 1
+	default:
+		return nil
+	}
+	args := data[4:]
+	end1, ok1 := abiStaticArrayEnd(args, first)
+	end2, ok2 := abiStaticArrayEnd(args, first+1)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	// Nothing appended still counts as unwrapped, so the transfer lists aren't
+	// scanned as text.
+	return []Call{{Data: args[max(end1, end2):]}}
+}
@@ -0,0 +1,77 @@
+package txmsg
+
+import (
+	"regexp"
+	"slices"
+)
+
+// Contacts is the contact information found in a message's text: exploit
+// negotiations and whitehat notes usually come down to an email address or a
+// handle to reach.
+type Contacts struct {
+	Emails  []string `json:"emails,omitempty"`
+	Handles []string `json:"handles,omitempty"` // @handles, with the @
+	Phones  []string `json:"phones,omitempty"`  // Phone-number-like tokens, as written
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// A handle is an @ that doesn't follow a word character, which would make
+	// it part of an email address.
+	handlePattern = regexp.MustCompile(`(?:^|[^\w.@])(@[A-Za-z0-9_]{2,30})\b`)
+	// A phone number is at least three groups of digits separated by spaces,
+	// dots or dashes, optionally starting with a + and a country code.
+	phonePattern = regexp.MustCompile(`\+?\d{1,4}(?:[ .-]\d{2,5}){2,}`)
+	// Dates and amounts with thousands separators look like phone numbers too.
+	isoDate   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	thousands = regexp.MustCompile(`^\d{1,3}(?:[ .]\d{3})+$`)
+)
+
+// Phone numbers have between minPhoneDigits and maxPhoneDigits digits (E.164).
+const (
+	minPhoneDigits = 7
+	maxPhoneDigits = 15
+)
+
+// ExtractContacts returns the email addresses, handles and phone numbers in
+// text, or nil if there are none. Each is reported once, in order of
+// appearance.
+func ExtractContacts(text string) *Contacts {
+	c := &Contacts{Emails: unique(emailPattern.FindAllString(text, -1))}
+	for _, m := range handlePattern.FindAllStringSubmatch(text, -1) {
+		c.Handles = appendUnique(c.Handles, m[1])
+	}
+	for _, phone := range phonePattern.FindAllString(text, -1) {
+		digits := 0
+		for _, r := range phone {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		if digits < minPhoneDigits || digits > maxPhoneDigits || isoDate.MatchString(phone) || thousands.MatchString(phone) {
+			continue
+		}
+		c.Phones = appendUnique(c.Phones, phone)
+	}
+	if c.Emails == nil && c.Handles == nil && c.Phones == nil {
+		return nil
+	}
+	return c
+}
+
+// unique returns ss without repeats, keeping the first of each.
+func unique(ss []string) []string {
+	var out []string
+	for _, s := range ss {
+		out = appendUnique(out, s)
+	}
+	return out
+}
+
+// appendUnique appends s to ss unless it is already there.
+func appendUnique(ss []string, s string) []string {
+	if slices.Contains(ss, s) {
+		return ss
+	}
+	return append(ss, s)
+}
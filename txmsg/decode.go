@@ -0,0 +1,342 @@
+package txmsg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMinLength is the minimum candidate length used by NewScanner.
+const DefaultMinLength = 4
+
+// Boundary extension limits, in runes (see matches).
+const (
+	maxBridge   = 2
+	maxTrailing = 3
+)
+
+// ContextSize is the number of bytes of decoded text reported on each side of
+// a candidate by DecodeContext.
+const ContextSize = 32
+
+// maxPooledBuffer caps the capacity of buffers returned to the pool, so one
+// huge calldata payload doesn't pin a large allocation for the whole run.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// Classes of ASCII bytes for the prescan (see hasCandidateRun).
+const (
+	asciiDropped = iota // Control bytes, which decodeUTF8 drops
+	asciiClass          // In the candidate pattern's class
+	asciiOther          // Printable but outside the class, ending a candidate
+)
+
+// asciiClasses classifies the ASCII bytes for the prescan; the entries of
+// bytes from utf8.RuneSelf up are unused.
+var asciiClasses = func() (t [256]uint8) {
+	for b := 0x20; b < 0x7f; b++ {
+		t[b] = asciiOther
+		if inClass(rune(b)) {
+			t[b] = asciiClass
+		}
+	}
+	return t
+}()
+
+// candidatePunct is the punctuation and symbols candidates may contain, enough
+// to keep sentences, URLs, email addresses and handles in one piece.
+const candidatePunct = ".,'!?-:/@#"
+
+// Runes of candidatePunct trimmed from the ends of candidates (see matches).
+// Sentence punctuation stays at the end, and handles and hashtags keep their
+// leading @ and #.
+const (
+	leadingSeparators  = ".,!?-:/ "
+	trailingSeparators = ",-:/ "
+)
+
+// CandidateExpr returns the regex matching candidate messages of at least
+// minLength letters, digits, spaces and candidatePunct runes. The apostrophe
+// is written as \x27 so the expression can be pasted into quoted SQL strings.
+func CandidateExpr(minLength int) string {
+	return fmt.Sprintf(`[\p{L}\p{N}\s.,\x27!?:/@#-]{%d,}`, minLength)
+}
+
+// UTF8Decoder reads calldata as UTF-8 text and returns the longest runs of
+// letters, digits, spaces and common punctuation.
+type UTF8Decoder struct {
+	pattern   *regexp.Regexp
+	minLength int
+}
+
+// NewUTF8Decoder returns a UTF8Decoder matching runs of at least minLength runes.
+func NewUTF8Decoder(minLength int) *UTF8Decoder {
+	pattern := regexp.MustCompile(CandidateExpr(minLength))
+	pattern.Longest()
+	return &UTF8Decoder{pattern: pattern, minLength: minLength}
+}
+
+// Name implements Decoder.
+func (d *UTF8Decoder) Name() string { return "utf8" }
+
+// String returns the candidate pattern, which holds the minimum length.
+func (d *UTF8Decoder) String() string { return d.pattern.String() }
+
+// Prescan implements Prescanner.
+func (d *UTF8Decoder) Prescan(data []byte) bool { return hasCandidateRun(data, d.minLength) }
+
+// Decode implements Decoder. The regex runs over the pooled decode buffer, so
+// only the matches are copied into strings.
+func (d *UTF8Decoder) Decode(data []byte) []string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	decodeUTF8(buf, data)
+
+	text := buf.Bytes()
+	var candidates []string
+	for _, loc := range matches(d.pattern, text) {
+		candidates = append(candidates, string(text[loc[0]:loc[1]]))
+	}
+	return candidates
+}
+
+// DecodeContext implements ContextDecoder.
+func (d *UTF8Decoder) DecodeContext(data []byte) []Candidate {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	decodeUTF8(buf, data)
+	return appendCandidates(nil, d.pattern, buf.Bytes())
+}
+
+// appendCandidates appends the matches of pattern in text, with their
+// context, to candidates.
+func appendCandidates(candidates []Candidate, pattern *regexp.Regexp, text []byte) []Candidate {
+	for _, loc := range matches(pattern, text) {
+		start, end := loc[0], loc[1]
+		before := max(start-ContextSize, 0)
+		for before < start && !utf8.RuneStart(text[before]) {
+			before++
+		}
+		after := min(end+ContextSize, len(text))
+		for after > end && after < len(text) && !utf8.RuneStart(text[after]) {
+			after--
+		}
+		candidates = append(candidates, Candidate{
+			Text:   string(text[start:end]),
+			Before: string(text[before:start]),
+			After:  string(text[end:after]),
+		})
+	}
+	return candidates
+}
+
+// hasCandidateRun is the prescan: it reports whether the pattern of a decoder
+// with minLength could match the decoded data, so calldata that can't hold a
+// candidate skips the decode and the regex. It walks data the way decodeUTF8
+// does, skipping what decodeUTF8 drops, and looks for minLength consecutive
+// runes of the pattern's class. That is necessary for a match, because
+// decodeUTF8 only ever removes runes, so text interleaved with dropped bytes
+// (UTF-16, NUL padding) passes. ASCII bytes cost a table lookup.
+func hasCandidateRun(data []byte, minLength int) bool {
+	run := 0
+	for i := 0; i < len(data); {
+		b := data[i]
+		if b < utf8.RuneSelf {
+			i++
+			switch asciiClasses[b] {
+			case asciiClass:
+				run++
+			case asciiOther:
+				run = 0
+			}
+		} else {
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError {
+				i++ // dropped like any invalid byte
+				continue
+			}
+			i += size
+			switch {
+			case !unicode.IsPrint(r):
+			case inClass(r):
+				run++
+			default:
+				run = 0
+			}
+		}
+		if run >= minLength {
+			return true
+		}
+	}
+	return false
+}
+
+// getBuffer returns an empty decode buffer from the pool.
+// Return it with putBuffer once done with its contents.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool unless it has grown too large.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// decodeUTF8 writes a cleaned-up UTF-8 version of data to buf. Invalid bytes
+// and non-printable runes are dropped and runs of spaces collapse to one.
+func decodeUTF8(buf *bytes.Buffer, data []byte) {
+	space := false
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError {
+			data = data[1:]
+			continue
+		}
+		data = data[size:]
+		if !unicode.IsPrint(r) {
+			continue
+		}
+		if unicode.IsSpace(r) {
+			space = buf.Len() > 0
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteRune(r)
+	}
+}
+
+// matches returns the locations of the candidates in text: the matches of
+// pattern, extended across the punctuation the pattern leaves out (quotes,
+// brackets, dashes). A match grows over runs of at most maxBridge such runes as
+// long as more of the pattern's class follows (or, going backwards, precedes)
+// them, even runs too short to match on their own, so `stop," he said` is one
+// candidate rather than two. Up to maxTrailing punctuation runes directly after
+// a candidate are kept ("stop!)"). Separators a candidate can't sensibly start
+// or end with, such as a leading comma or a trailing colon, are trimmed.
+func matches(pattern *regexp.Regexp, text []byte) [][]int {
+	var locs [][]int
+	for _, loc := range pattern.FindAllIndex(text, -1) {
+		if n := len(locs); n > 0 && loc[0] < locs[n-1][1] {
+			continue // already covered by the previous candidate
+		}
+		start, end := loc[0], loc[1]
+		for {
+			p := punctRun(text[end:], maxBridge)
+			c := classRun(text[end+p:])
+			if p == 0 || c == 0 {
+				break
+			}
+			end += p + c
+		}
+		end += punctRun(text[end:], maxTrailing)
+		for {
+			p := punctRunBefore(text[:start], maxBridge)
+			c := classRunBefore(text[:start-p])
+			if p == 0 || c == 0 {
+				break
+			}
+			start -= p + c
+		}
+		if n := len(locs); n > 0 && start < locs[n-1][1] {
+			start = locs[n-1][1] // the previous candidate's trailing punctuation
+		}
+		start, end = trimSeparators(text, start, end)
+		if start < end {
+			locs = append(locs, []int{start, end})
+		}
+	}
+	return locs
+}
+
+// trimSeparators returns start and end moved past the leadingSeparators at the
+// start and the trailingSeparators at the end of text[start:end].
+func trimSeparators(text []byte, start, end int) (int, int) {
+	for start < end {
+		r, size := utf8.DecodeRune(text[start:end])
+		if !strings.ContainsRune(leadingSeparators, r) {
+			break
+		}
+		start += size
+	}
+	for start < end {
+		r, size := utf8.DecodeLastRune(text[start:end])
+		if !strings.ContainsRune(trailingSeparators, r) {
+			break
+		}
+		end -= size
+	}
+	return start, end
+}
+
+// punctRun returns the length in bytes of the run of at most limit
+// punctuation runes at the start of text.
+func punctRun(text []byte, limit int) int {
+	n := 0
+	for i := 0; i < limit && n < len(text); i++ {
+		r, size := utf8.DecodeRune(text[n:])
+		if !unicode.IsPunct(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// punctRunBefore returns the length in bytes of the run of at most limit
+// punctuation runes at the end of text.
+func punctRunBefore(text []byte, limit int) int {
+	n := 0
+	for i := 0; i < limit && n < len(text); i++ {
+		r, size := utf8.DecodeLastRune(text[:len(text)-n])
+		if !unicode.IsPunct(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// classRun returns the length in bytes of the run of runes in the candidate
+// pattern's class at the start of text.
+func classRun(text []byte) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRune(text[n:])
+		if !inClass(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// classRunBefore returns the length in bytes of the run of runes in the
+// candidate pattern's class at the end of text.
+func classRunBefore(text []byte) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeLastRune(text[:len(text)-n])
+		if !inClass(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// inClass reports whether r is in the candidate pattern's character class.
+func inClass(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == ' ' || strings.ContainsRune(candidatePunct, r)
+}
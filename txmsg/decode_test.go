@@ -0,0 +1,178 @@
+package txmsg
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16LE encodes s as little-endian UTF-16.
+func utf16LE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+// interleave puts sep after every byte of s.
+func interleave(s string, sep byte) []byte {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i], sep)
+	}
+	return b
+}
+
+// abiString encodes s as the only argument of a call with selector sel.
+func abiString(sel []byte, s string) []byte {
+	word := func(n int) []byte {
+		w := make([]byte, 32)
+		w[31] = byte(n)
+		return w
+	}
+	data := append(append(append([]byte{}, sel...), word(32)...), word(len(s))...)
+	data = append(data, s...)
+	return append(data, make([]byte, 32-len(s)%32)...)
+}
+
+func TestScanDataInterleavedText(t *testing.T) {
+	large := func(msg []byte) []byte {
+		return append(append(make([]byte, DefaultLargeSize), msg...), make([]byte, 64)...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"plain", []byte("hello there my friend"), "hello there my friend"},
+		{"utf16le", utf16LE("hello there my friend"), "hello there my friend"},
+		{"utf16be", append([]byte{0}, interleave("hello there my friend", 0)...), "hello there my friend"},
+		{"utf16 punctuation", utf16LE("gm, 100 ETH? nice, friend!"), "gm, 100 ETH? nice, friend!"},
+		{"control bytes", interleave("hello there my friend", 0x01), "hello there my friend"},
+		{"invalid bytes", interleave("hello there my friend", 0xff), "hello there my friend"},
+		{"abi string", abiString([]byte{0x12, 0x84, 0x96, 0xf8}, "gm ser, nice vault"), "gm ser, nice vault"},
+		{"short", []byte("hey you"), "hey you"},
+		{"large", large([]byte("the quick brown fox jumps")), "the quick brown fox jumps"},
+		{"large utf16", large(utf16LE("the quick brown fox jumps")), "the quick brown fox jumps"},
+		{"large short run", large([]byte("\xffgm ser nice vault bro\xff")), "gm ser nice vault bro"},
+	}
+	s := NewScanner()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, msg := range s.ScanData(tt.data) {
+				got = append(got, msg.Text)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("ScanData = %q, want [%q]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrescanRejectsBinary(t *testing.T) {
+	transfer := append([]byte{0xa9, 0x05, 0x9c, 0xbb}, make([]byte, 64)...)
+	copy(transfer[16:36], bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 5))
+	transfer[67] = 0xe8
+	for name, data := range map[string][]byte{
+		"empty":    nil,
+		"zeros":    make([]byte, 256),
+		"transfer": transfer,
+		"short":    []byte("\x00a\x00b\x00c\x00"),
+		"broken":   []byte("ab\"cd(ef)gh"),
+	} {
+		if hasCandidateRun(data, DefaultMinLength) {
+			t.Errorf("%s: prescan passed", name)
+		}
+	}
+}
+
+// TestPrescanIsNecessary checks that calldata the prescan rejects never holds
+// a candidate, so the prescan only ever saves work.
+func TestPrescanIsNecessary(t *testing.T) {
+	// Mostly ASCII, with control bytes, invalid bytes and multi-byte runes.
+	alphabet := []byte("ab c.\"(\x00\x01\xff\xc3\xa9\xe2\x80\x9c\xef\xbf\xbd")
+	rng := rand.New(rand.NewSource(1))
+	for _, minLength := range []int{1, 2, 4, 7} {
+		d := NewUTF8Decoder(minLength)
+		for i := 0; i < 20000; i++ {
+			data := make([]byte, rng.Intn(24))
+			for j := range data {
+				if rng.Intn(4) == 0 {
+					data[j] = byte(rng.Intn(256))
+				} else {
+					data[j] = alphabet[rng.Intn(len(alphabet))]
+				}
+			}
+			var buf bytes.Buffer
+			decodeUTF8(&buf, data)
+			found := d.pattern.Match(buf.Bytes())
+			if found && !hasCandidateRun(data, minLength) {
+				t.Fatalf("minLength %d: prescan rejected %q, which decodes to candidate text %q", minLength, data, buf.String())
+			}
+		}
+	}
+}
+
+func TestStreamDecoderMatchesUTF8Decoder(t *testing.T) {
+	for _, text := range []string{
+		"hello there my friend",
+		"Contact us at whitehat@example.com to return the funds",
+		strings.Repeat("so long ", 20),
+	} {
+		for _, data := range [][]byte{[]byte(text), utf16LE(text)} {
+			want := NewUTF8Decoder(DefaultMinLength).Decode(data)
+			got := NewStreamDecoder(DefaultMinLength).Decode(data)
+			if strings.Join(got, "|") != strings.Join(want, "|") {
+				t.Errorf("StreamDecoder.Decode(%q) = %q, UTF8Decoder found %q", data, got, want)
+			}
+		}
+	}
+}
+
+// accepted returns the candidates t accepted, including those of nested calls.
+func accepted(t *Trace) []string {
+	var texts []string
+	for _, n := range t.Nested {
+		texts = append(texts, accepted(n)...)
+	}
+	for _, d := range t.Decoders {
+		for _, c := range d.Candidates {
+			if c.Accepted {
+				texts = append(texts, c.Text)
+			}
+		}
+	}
+	return texts
+}
+
+func TestExplainMatchesScan(t *testing.T) {
+	s := NewScanner()
+	for _, data := range [][]byte{
+		[]byte("gm frens, hope the markets are kind to you today"),
+		utf16LE("Contact us at whitehat@example.com to return the funds"),
+		abiString([]byte{0xde, 0xad, 0xbe, 0xef}, "please return the stolen funds"),
+		{0x00, 0x01, 0xff, 0xfe},
+	} {
+		var want []string
+		for _, msg := range s.ScanCall(Call{Data: data}) {
+			want = append(want, msg.Text)
+		}
+		if got := accepted(s.Explain(Call{Data: data})); strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("Explain(%q) accepted %q, ScanCall found %q", data, got, want)
+		}
+	}
+}
+
+func TestExplainPrescan(t *testing.T) {
+	trace := NewScanner().Explain(Call{Data: []byte{0x00, 0x01, 0xff, 0xfe, 0x00, 0x02}})
+	if len(trace.Decoders) == 0 || trace.Decoders[0].Decoder != "utf8" {
+		t.Fatalf("decoders traced: %+v", trace.Decoders)
+	}
+	if d := trace.Decoders[0]; !d.Prescanned || len(d.Candidates) > 0 {
+		t.Errorf("utf8 decoder: prescanned %v with candidates %v, want a prescan rejection", d.Prescanned, d.Candidates)
+	}
+}
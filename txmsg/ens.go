@@ -0,0 +1,85 @@
+package txmsg
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// ENS resolver record setters.
+const (
+	setTextSelector        = "10f13a8c" // setText(bytes32 node, string key, string value)
+	setContenthashSelector = "304e6ade" // setContenthash(bytes32 node, bytes hash)
+)
+
+// Multicodec prefixes of ENS content hashes (EIP-1577).
+const (
+	codecIPFS  = 0xe3
+	codecSwarm = 0xe4
+	codecIPNS  = 0xe5
+)
+
+// cidEncoding is the lowercase, unpadded base32 of multibase prefix "b".
+var cidEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ENSDecoder reads the record values ENS names publish through their resolver:
+// text records ("description: ...", "url: ...", custom keys) and content hashes
+// ("contenthash: ipfs://..."). Values are returned whole, punctuation included.
+type ENSDecoder struct{}
+
+// Name implements Decoder.
+func (ENSDecoder) Name() string { return "ens" }
+
+// Claims implements Claimer: record setter calls are left to the ENS decoder,
+// so a text record isn't also reported as raw calldata text.
+func (ENSDecoder) Claims(data []byte) bool {
+	sel := selectorOf(data)
+	return sel == setTextSelector || sel == setContenthashSelector
+}
+
+// Decode implements Decoder.
+func (ENSDecoder) Decode(data []byte) []string {
+	if args, ok := abiArgs(data, setTextSelector); ok {
+		key, ok1 := abiBytes(args, 1)
+		value, ok2 := abiBytes(args, 2)
+		if !ok1 || !ok2 || len(value) == 0 || !utf8.Valid(key) || !utf8.Valid(value) {
+			return nil
+		}
+		return []string{string(key) + ": " + strings.TrimSpace(string(value))}
+	}
+	if args, ok := abiArgs(data, setContenthashSelector); ok {
+		hash, ok := abiBytes(args, 1)
+		if !ok {
+			return nil
+		}
+		if uri := contenthashURI(hash); uri != "" {
+			return []string{"contenthash: " + uri}
+		}
+	}
+	return nil
+}
+
+// contenthashURI formats an EIP-1577 content hash as a URI, or returns "" for
+// codecs it doesn't know.
+func contenthashURI(hash []byte) string {
+	codec, n := binary.Uvarint(hash)
+	if n <= 0 {
+		return ""
+	}
+	rest := hash[n:]
+	switch codec {
+	case codecIPFS:
+		return "ipfs://b" + cidEncoding.EncodeToString(rest)
+	case codecIPNS:
+		return "ipns://b" + cidEncoding.EncodeToString(rest)
+	case codecSwarm:
+		// CIDv1, swarm-manifest, keccak-256 multihash: the last 32 bytes are the hash.
+		if len(rest) < 32 {
+			return ""
+		}
+		return "bzz://" + hex.EncodeToString(rest[len(rest)-32:])
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package txmsg
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestENSSelectors(t *testing.T) {
+	for selector, sig := range map[string]string{
+		setTextSelector:        "setText(bytes32,string,string)",
+		setContenthashSelector: "setContenthash(bytes32,bytes)",
+	} {
+		if got := hex.EncodeToString(crypto.Keccak256([]byte(sig))[:4]); got != selector {
+			t.Errorf("selector of %s = %s, have %s", sig, got, selector)
+		}
+	}
+}
+
+func TestENSSetterScannedOnce(t *testing.T) {
+	node := crypto.Keccak256Hash([]byte("gm.eth"))
+	ipfs, err := hex.DecodeString("e3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{
+			"setText",
+			encode(t, "setText", args(arg("node", "bytes32"), arg("key", "string"), arg("value", "string")),
+				node, "description", "Building public goods for the open internet, one block at a time"),
+			"description: Building public goods for the open internet, one block at a time",
+		},
+		{
+			"setContenthash",
+			encode(t, "setContenthash", args(arg("node", "bytes32"), arg("hash", "bytes")), node, ipfs),
+			"contenthash: ipfs://bafybeibj6lixxzqtsb45ysdjnupvqkufgdvzqbnvmhw2kf7cfkesy7r7d4",
+		},
+	} {
+		s := NewScanner()
+		msgs := s.ScanCall(Call{From: otherAddr, To: &targetAddr, Data: tt.data})
+		if len(msgs) != 1 || msgs[0].Text != tt.want || msgs[0].Decoder != "ens" {
+			t.Errorf("%s: scanned %+v, want only %q from the ens decoder", tt.name, msgs, tt.want)
+		}
+		if trace := s.Explain(Call{Data: tt.data}); trace.Claimed != "ens" || len(trace.Decoders) != 1 {
+			t.Errorf("%s: trace claimed by %q with %d decoders, want ens alone", tt.name, trace.Claimed, len(trace.Decoders))
+		}
+	}
+}
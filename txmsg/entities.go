@@ -0,0 +1,85 @@
+package txmsg
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Entity types reported in Message.Entities.
+const (
+	EntityDate        = "date"
+	EntityCoordinates = "coordinates"
+	EntityETHAddress  = "eth-address"
+	EntityBTCAddress  = "btc-address"
+	EntityTxHash      = "tx-hash"
+	EntityAmount      = "amount"
+)
+
+// Entity is a piece of structured content quoted in a message.
+type Entity struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`            // As written in the message
+	Value string `json:"value,omitempty"` // Normalised form, e.g. a checksummed address
+}
+
+var (
+	datePattern        = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:Z|[+-]\d{2}:?\d{2})?)?\b`)
+	coordinatesPattern = regexp.MustCompile(`(-?\d{1,2}\.\d{3,})\s*,\s*(-?\d{1,3}\.\d{3,})`)
+	ethAddressPattern  = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+	txHashPattern      = regexp.MustCompile(`\b0x[0-9a-fA-F]{64}\b`)
+	btcAddressPattern  = regexp.MustCompile(`\b(?:[13][1-9A-HJ-NP-Za-km-z]{25,34}|bc1[02-9ac-hj-np-z]{11,71})\b`)
+	amountPattern      = regexp.MustCompile(`(?i)(?:\$\s?(\d[\d,]*(?:\.\d+)?)|\b(\d[\d,]*(?:\.\d+)?)\s?(eth|weth|btc|wbtc|usdc|usdt|dai|usd)\b)`)
+)
+
+// dateLayouts are the accepted forms of datePattern matches.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04Z07:00", "2006-01-02 15:04:05",
+	"2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", time.DateOnly}
+
+// ExtractEntities returns the dates, coordinates, addresses, transaction hashes
+// and amounts quoted in text, in order of appearance within each type. Dates
+// that aren't real calendar dates and coordinates out of range are left out.
+func ExtractEntities(text string) []Entity {
+	var entities []Entity
+	for _, m := range datePattern.FindAllString(text, -1) {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, m); err == nil {
+				value := t.Format(time.DateOnly)
+				if len(m) > len(time.DateOnly) {
+					value = t.Format(time.RFC3339)
+				}
+				entities = append(entities, Entity{Type: EntityDate, Text: m, Value: value})
+				break
+			}
+		}
+	}
+	for _, m := range coordinatesPattern.FindAllStringSubmatch(text, -1) {
+		lat, _ := strconv.ParseFloat(m[1], 64)
+		lon, _ := strconv.ParseFloat(m[2], 64)
+		if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			continue
+		}
+		entities = append(entities, Entity{Type: EntityCoordinates, Text: m[0], Value: m[1] + "," + m[2]})
+	}
+	for _, m := range ethAddressPattern.FindAllString(text, -1) {
+		entities = append(entities, Entity{Type: EntityETHAddress, Text: m, Value: common.HexToAddress(m).Hex()})
+	}
+	for _, m := range txHashPattern.FindAllString(text, -1) {
+		entities = append(entities, Entity{Type: EntityTxHash, Text: m, Value: common.HexToHash(m).Hex()})
+	}
+	for _, m := range btcAddressPattern.FindAllString(text, -1) {
+		entities = append(entities, Entity{Type: EntityBTCAddress, Text: m})
+	}
+	for _, m := range amountPattern.FindAllStringSubmatch(text, -1) {
+		number, unit := m[1], "USD"
+		if number == "" {
+			number, unit = m[2], strings.ToUpper(m[3])
+		}
+		number = strings.ReplaceAll(number, ",", "")
+		entities = append(entities, Entity{Type: EntityAmount, Text: m[0], Value: number + " " + unit})
+	}
+	return entities
+}
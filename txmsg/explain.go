@@ -0,0 +1,51 @@
+package txmsg
+
+// Explainer is a Validator that can say why it accepts or rejects a
+// candidate. Scanner.Explain includes the explanation in its trace.
+type Explainer interface {
+	Validator
+	Explain(candidate string) string
+}
+
+// Trace is a step-by-step account of how a Scanner handles a call, for
+// debugging why a message was or wasn't found.
+type Trace struct {
+	Call      Call
+	Skipped   string   // Why the call wasn't decoded, e.g. a known selector; empty if it was
+	Unwrapper string   // Name of the unwrapper that opened the call, if one did
+	Nested    []*Trace // Traces of the calls the unwrapper found
+	Large     bool     // The calldata went through the large-payload pipeline
+	Claimed   string   // Name of the decoder that claimed the calldata, so no other ran
+	Decoders  []DecoderTrace
+}
+
+// DecoderTrace is what one decoder made of a call's calldata.
+type DecoderTrace struct {
+	Decoder    string
+	Prescanned bool // The decoder's prescan ruled the calldata out, so it wasn't decoded
+	Candidates []CandidateTrace
+}
+
+// CandidateTrace is one candidate and the validators' verdicts on it.
+type CandidateTrace struct {
+	Text      string
+	Duplicate bool // Same text as a candidate already accepted for this call, so not validated again
+	Checks    []Check
+	Accepted  bool
+}
+
+// Check is one validator's verdict on a candidate.
+type Check struct {
+	Validator string
+	Passed    bool
+	Detail    string // The validator's explanation, if it is an Explainer
+}
+
+// Explain traces how s handles call. The trace is recorded by the same code
+// that runs for ScanCall: unwrapping, the selector gate, each decoder's
+// prescan and candidates, and each validator's verdict on them.
+func (s *Scanner) Explain(call Call) *Trace {
+	t := &Trace{Call: call}
+	s.scan(call, 0, t)
+	return t
+}
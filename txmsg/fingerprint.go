@@ -0,0 +1,112 @@
+package txmsg
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Fingerprint is a 64-bit simhash of a message's text. Texts that differ only
+// in case, punctuation or spacing get the same fingerprint, and texts with
+// small edits get fingerprints a few bits apart, so a message copied by other
+// senders can be traced back to its first writer.
+type Fingerprint uint64
+
+// SameTextDistance is the largest number of differing bits between the
+// fingerprints of two texts taken to be the same message, republished with
+// small edits.
+const SameTextDistance = 3
+
+// shingleSize is the length, in runes, of the overlapping pieces of text that
+// are hashed into a fingerprint.
+const shingleSize = 4
+
+// FingerprintText returns the fingerprint of text, or 0 if text has no letters
+// or digits.
+func FingerprintText(text string) Fingerprint {
+	// Normalise to lowercase words separated by single spaces.
+	var norm []rune
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len(norm) > 0 {
+			norm = append(norm, ' ')
+		}
+		norm = append(norm, []rune(w)...)
+	}
+	if len(norm) == 0 {
+		return 0
+	}
+
+	// Each shingle votes on every bit by its hash; the fingerprint has the
+	// bits that most shingles set.
+	var votes [64]int
+	h := fnv.New64a()
+	for i := 0; i+shingleSize <= max(len(norm), shingleSize); i++ {
+		h.Reset()
+		h.Write([]byte(string(norm[i:min(i+shingleSize, len(norm))])))
+		sum := h.Sum64()
+		for b := range votes {
+			if sum&(1<<b) != 0 {
+				votes[b]++
+			} else {
+				votes[b]--
+			}
+		}
+	}
+	var fp Fingerprint
+	for b, v := range votes {
+		if v > 0 {
+			fp |= 1 << b
+		}
+	}
+	return fp
+}
+
+// Distance returns the number of bits in which f and g differ.
+func (f Fingerprint) Distance(g Fingerprint) int {
+	return bits.OnesCount64(uint64(f ^ g))
+}
+
+// SameText reports whether f and g are fingerprints of the same text, allowing
+// for small edits.
+func (f Fingerprint) SameText(g Fingerprint) bool {
+	return f != 0 && g != 0 && f.Distance(g) <= SameTextDistance
+}
+
+// String returns f as 16 hex digits.
+func (f Fingerprint) String() string {
+	return fmt.Sprintf("%016x", uint64(f))
+}
+
+// MarshalText encodes f as 16 hex digits, which unlike a JSON number survives
+// JavaScript clients.
+func (f Fingerprint) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText decodes f from hex digits.
+func (f *Fingerprint) UnmarshalText(text []byte) error {
+	n, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return fmt.Errorf("fingerprint %q: %w", text, err)
+	}
+	*f = Fingerprint(n)
+	return nil
+}
+
+// Attribution names the first writer of a message: the earliest stored
+// message with the same text, allowing for small edits.
+type Attribution struct {
+	TxHash  common.Hash    `json:"txHash"`
+	ChainID uint64         `json:"chainId,omitempty"` // Chain the tx is on, zero if unknown
+	Block   uint64         `json:"block"`
+	Time    uint64         `json:"time"`
+	From    common.Address `json:"from"`
+	Copies  int            `json:"copies"` // Other transactions that republished the text
+}
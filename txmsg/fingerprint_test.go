@@ -0,0 +1,108 @@
+package txmsg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFingerprintSameText(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+	}{
+		{"Hello world, this is a message", "Hello world, this is a message"},
+		{"Hello world, this is a message", "hello WORLD this is a message!!"},
+		{"Hello world, this is a message", "  hello   world,\nthis is a message  "},
+		{"please return my funds, you took 10 eth from me", "please return my funds, you took 10 eth from me."},
+		{"please return my funds, you took 10 eth from me", "please return my funds you took 10 eth from me :("},
+	} {
+		a, b := FingerprintText(tt.a), FingerprintText(tt.b)
+		if !a.SameText(b) {
+			t.Errorf("%q and %q: distance %d, want at most %d", tt.a, tt.b, a.Distance(b), SameTextDistance)
+		}
+	}
+}
+
+func TestFingerprintDifferentText(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+	}{
+		{"Hello world, this is a message", "please return my funds, you took 10 eth from me"},
+		{"gm frens, wagmi", "the quick brown fox jumps over the lazy dog"},
+		{"happy birthday mom, love you", "I will find you and get my money back"},
+		{"Hello world, this is a message", "Goodbye world, that was a message"},
+	} {
+		a, b := FingerprintText(tt.a), FingerprintText(tt.b)
+		if a.SameText(b) {
+			t.Errorf("%q and %q: distance %d, want more than %d", tt.a, tt.b, a.Distance(b), SameTextDistance)
+		}
+	}
+}
+
+func TestFingerprintEmpty(t *testing.T) {
+	for _, text := range []string{"", "   ", "!!! ??? ...", "\x00\x01"} {
+		if fp := FingerprintText(text); fp != 0 {
+			t.Errorf("FingerprintText(%q) = %s, want 0", text, fp)
+		}
+	}
+	// Texts without letters or digits are never the same text, even as each other.
+	if Fingerprint(0).SameText(0) {
+		t.Error("zero fingerprints are the same text")
+	}
+	if fp := FingerprintText("ab"); fp == 0 {
+		t.Error("text shorter than a shingle has no fingerprint")
+	}
+}
+
+func TestFingerprintDistance(t *testing.T) {
+	for _, tt := range []struct {
+		f, g Fingerprint
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0b1010, 0b0101, 4},
+		{0, ^Fingerprint(0), 64},
+		{0xff00, 0x0ff0, 8},
+	} {
+		if got := tt.f.Distance(tt.g); got != tt.want {
+			t.Errorf("%s.Distance(%s) = %d, want %d", tt.f, tt.g, got, tt.want)
+		}
+		if got := tt.g.Distance(tt.f); got != tt.want {
+			t.Errorf("%s.Distance(%s) = %d, want %d", tt.g, tt.f, got, tt.want)
+		}
+	}
+
+	f := Fingerprint(0x0123456789abcdef)
+	for bits, want := range map[Fingerprint]bool{
+		0b1: true, 0b111: true, 0b1111: false, 1 << 63: true,
+	} {
+		if got := f.SameText(f ^ bits); got != want {
+			t.Errorf("SameText with %d bits flipped = %v, want %v", f.Distance(f^bits), got, want)
+		}
+	}
+}
+
+func TestFingerprintText(t *testing.T) {
+	f := FingerprintText("hello world, this is a message")
+	b, err := json.Marshal(map[string]Fingerprint{"fp": f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]Fingerprint
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["fp"] != f {
+		t.Errorf("round trip through %s = %s, want %s", b, got["fp"], f)
+	}
+	if s := Fingerprint(0xab).String(); s != "00000000000000ab" {
+		t.Errorf("String() = %q", s)
+	}
+
+	for _, text := range []string{"", "xyz", "-1", "10000000000000000"} {
+		var fp Fingerprint
+		if err := fp.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %s, want an error", text, fp)
+		}
+	}
+}
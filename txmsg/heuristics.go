@@ -0,0 +1,132 @@
+package txmsg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Heuristics is the default Validator. It accepts candidates made mostly of
+// letters with enough plausible words.
+type Heuristics struct {
+	MinWords       int     // Minimum words in valid message
+	MinWordLength  int     // Minimum word length in valid message
+	LetterRatio    float64 // Minimum ratio of letters in valid message
+	SkipVowelCheck bool    // Count words without a vowel as valid
+}
+
+// DefaultHeuristics are the thresholds used by NewScanner.
+var DefaultHeuristics = Heuristics{
+	MinWords:      2,
+	MinWordLength: 3,
+	LetterRatio:   0.6,
+}
+
+// HeuristicPresets are named threshold sets, from fewest to most false
+// positives: "strict", "balanced" (DefaultHeuristics) and "lenient".
+var HeuristicPresets = map[string]Heuristics{
+	"strict": {
+		MinWords:      3,
+		MinWordLength: 3,
+		LetterRatio:   0.75,
+	},
+	"balanced": DefaultHeuristics,
+	"lenient": {
+		MinWords:       2,
+		MinWordLength:  3,
+		LetterRatio:    0.4,
+		SkipVowelCheck: true,
+	},
+}
+
+// Validate reports thresholds that can't accept anything sensible.
+func (h Heuristics) Validate() error {
+	switch {
+	case h.MinWords < 1:
+		return fmt.Errorf("minimum words %d must be at least 1", h.MinWords)
+	case h.MinWordLength < 1:
+		return fmt.Errorf("minimum word length %d must be at least 1", h.MinWordLength)
+	case h.LetterRatio < 0 || h.LetterRatio > 1:
+		return fmt.Errorf("letter ratio %g must be between 0 and 1", h.LetterRatio)
+	}
+	return nil
+}
+
+// quotedHex matches the addresses and tx hashes messages quote, which are left
+// out of the letter ratio so that a note citing them isn't mistaken for data.
+var quotedHex = regexp.MustCompile(`\b0x(?:[0-9a-fA-F]{64}|[0-9a-fA-F]{40})\b`)
+
+// Measures are what Heuristics judge a candidate by. Addresses and tx hashes
+// quoted in the candidate are left out.
+type Measures struct {
+	Words       int     // Whitespace-separated words
+	ValidWords  int     // Words of at least MinWordLength with a letter and, unless SkipVowelCheck is set, a vowel
+	LetterRatio float64 // Share of letters among the runes that aren't spaces
+}
+
+// Measure returns the measures of s under h's word rules.
+func (h Heuristics) Measure(s string) Measures {
+	if strings.Contains(s, "0x") {
+		s = quotedHex.ReplaceAllString(s, "")
+	}
+	var m Measures
+	for _, word := range strings.Fields(s) {
+		m.Words++
+		if len(word) >= h.MinWordLength && hasLetters(word) && (h.SkipVowelCheck || hasVowel(word)) {
+			m.ValidWords++
+		}
+	}
+	letters, chars := 0, 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+		if !unicode.IsSpace(r) {
+			chars++
+		}
+	}
+	if chars > 0 {
+		m.LetterRatio = float64(letters) / float64(chars)
+	}
+	return m
+}
+
+// Valid applies the heuristics (letter ratio and valid words) to the message.
+func (h Heuristics) Valid(s string) bool {
+	m := h.Measure(s)
+	return m.Words >= h.MinWords && m.LetterRatio >= h.LetterRatio && m.ValidWords >= h.MinWords
+}
+
+// Explain implements Explainer, giving the measures Valid compares against
+// the thresholds.
+func (h Heuristics) Explain(s string) string {
+	m := h.Measure(s)
+	vowels := ", with a vowel"
+	if h.SkipVowelCheck {
+		vowels = ""
+	}
+	return fmt.Sprintf("%d words (need %d); %d valid words of %d+ letters%s (need %d); letter ratio %.2f (need %.2f)",
+		m.Words, h.MinWords, m.ValidWords, h.MinWordLength, vowels, h.MinWords, m.LetterRatio, h.LetterRatio)
+}
+
+// hasLetters checks if there is at least one letter in the string.
+func hasLetters(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVowel returns true if the string contains at least one vowel (a, e, i, o, u).
+func hasVowel(s string) bool {
+	for _, r := range s {
+		switch unicode.ToLower(r) {
+		case 'a', 'e', 'i', 'o', 'u':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package txmsg
+
+import "testing"
+
+func TestHeuristicsMeasure(t *testing.T) {
+	for _, tt := range []struct {
+		text  string
+		want  Measures
+		valid bool
+	}{
+		{"hello there friend", Measures{Words: 3, ValidWords: 3, LetterRatio: 1}, true},
+		{"gm ser", Measures{Words: 2, ValidWords: 1, LetterRatio: 1}, false},
+		{"xyz qrst", Measures{Words: 2, ValidWords: 0, LetterRatio: 1}, false},
+		{"abc 1234", Measures{Words: 2, ValidWords: 1, LetterRatio: 3.0 / 7}, false},
+		{"send to 0x52908400098527886E0F7030069857D2E4169EE7 please",
+			Measures{Words: 3, ValidWords: 2, LetterRatio: 1}, true},
+		{"", Measures{}, false},
+	} {
+		if got := DefaultHeuristics.Measure(tt.text); got != tt.want {
+			t.Errorf("Measure(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+		if got := DefaultHeuristics.Valid(tt.text); got != tt.valid {
+			t.Errorf("Valid(%q) = %v, want %v", tt.text, got, tt.valid)
+		}
+	}
+
+	lenient := HeuristicPresets["lenient"]
+	if m := lenient.Measure("xyz qrst"); m.ValidWords != 2 {
+		t.Errorf("lenient Measure counts %d valid words without vowels, want 2", m.ValidWords)
+	}
+}
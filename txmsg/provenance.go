@@ -0,0 +1,69 @@
+package txmsg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Provenance records how a message was found, so that archive segments
+// produced by different versions and configurations can be told apart.
+type Provenance struct {
+	Version    string   `json:"version"`            // Version of the program that ran the scanner
+	ConfigHash string   `json:"configHash"`         // Scanner.ConfigHash of the scanner
+	Decoders   []string `json:"decoders"`           // Names of the decoders the scanner ran, large-payload ones last
+	Provider   string   `json:"provider,omitempty"` // Host of the RPC endpoint the transaction came from
+}
+
+// NewProvenance returns the provenance of messages found by s in a program at
+// version, reading transactions from provider.
+func NewProvenance(s *Scanner, version, provider string) *Provenance {
+	var decoders []string
+	for _, d := range slices.Concat(s.Decoders, s.LargeDecoders) {
+		if !slices.Contains(decoders, d.Name()) {
+			decoders = append(decoders, d.Name())
+		}
+	}
+	return &Provenance{Version: version, ConfigHash: s.ConfigHash(), Decoders: decoders, Provider: provider}
+}
+
+// ConfigHash returns a short hash of the detection configuration: the
+// decoders, validators and unwrappers with their settings, the skipped
+// selectors and the large-payload split. Scanners with the same hash find the
+// same messages in the same calldata.
+func (s *Scanner) ConfigHash() string {
+	var b strings.Builder
+	for _, d := range s.Decoders {
+		fmt.Fprintf(&b, "decoder %s\n", describe(d))
+	}
+	for _, v := range s.Validators {
+		fmt.Fprintf(&b, "validator %s\n", describe(v))
+	}
+	for _, u := range s.Unwrappers {
+		fmt.Fprintf(&b, "unwrapper %s\n", describe(u))
+	}
+	for _, sel := range slices.Sorted(maps.Keys(s.Selectors)) {
+		fmt.Fprintf(&b, "selector %s\n", sel)
+	}
+	fmt.Fprintf(&b, "contacts %t\nlarge %d\n", !s.SkipContacts, s.LargeSize)
+	for _, d := range s.LargeDecoders {
+		fmt.Fprintf(&b, "large decoder %s\n", describe(d))
+	}
+	for _, v := range s.LargeValidators {
+		fmt.Fprintf(&b, "large validator %s\n", describe(v))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// describe returns the type and settings of a pipeline component: its String
+// if it has one, or its fields.
+func describe(v any) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return fmt.Sprintf("%T %s", v, s)
+	}
+	return fmt.Sprintf("%T %+v", v, v)
+}
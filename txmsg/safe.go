@@ -0,0 +1,41 @@
+package txmsg
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// execTransaction(address to, uint256 value, bytes data, uint8 operation,
+// uint256 safeTxGas, uint256 baseGas, uint256 gasPrice, address gasToken,
+// address refundReceiver, bytes signatures)
+const execTransactionSelector = "6a761202"
+
+// SafeUnwrapper opens up Safe (Gnosis Safe) multisig transactions. The inner
+// call is attributed to the Safe. The signatures, whose contract-signature part
+// can carry arbitrary bytes, are returned as a call from the Safe to itself so
+// they are scanned too. The refund fields (gas token and receiver) are
+// addresses and carry no text.
+type SafeUnwrapper struct{}
+
+// Name implements Unwrapper.
+func (SafeUnwrapper) Name() string { return "safe" }
+
+// Unwrap implements Unwrapper.
+func (SafeUnwrapper) Unwrap(safe common.Address, data []byte) []Call {
+	args, ok := abiArgs(data, execTransactionSelector)
+	if !ok {
+		return nil
+	}
+	to, ok1 := abiAddress(args, 0)
+	value, ok2 := abiInt(args, 1)
+	inner, ok3 := abiBytes(args, 2)
+	if !ok1 || !ok2 || !ok3 {
+		return nil
+	}
+	calls := []Call{{From: safe, To: &to, Value: value, Data: inner}}
+	if sigs, ok := abiBytes(args, 9); ok && len(sigs) > 0 {
+		calls = append(calls, Call{From: safe, To: &safe, Value: new(big.Int), Data: sigs})
+	}
+	return calls
+}
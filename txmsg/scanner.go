@@ -0,0 +1,298 @@
+package txmsg
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"maps"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// KnownSelectors are common Ethereum function signatures (first 4 bytes of the
+// keccak256 hash). Calldata starting with one of them is a contract call, not
+// a message.
+var KnownSelectors = map[string]string{
+	"a9059cbb": "ERC20 transfer",
+	"23b872dd": "ERC20 transferFrom",
+	"095ea7b3": "ERC20 approve",
+	"42842e0e": "ERC721 safeTransferFrom",
+	"b88d4fde": "ERC721 safeTransferFrom with data",
+	"a22cb465": "setApprovalForAll",
+	"6352211e": "ownerOf (ERC721)",
+	"70a08231": "balanceOf",
+	"06fdde03": "name()",
+	"95d89b41": "symbol()",
+}
+
+// maxUnwrapDepth limits how deeply wrapper calls are unwrapped, e.g. a Safe
+// executing a Safe transaction.
+const maxUnwrapDepth = 4
+
+// Scanner finds messages in transactions. Every candidate produced by any of
+// Decoders must pass all Validators to become a Message. Calldata that one of
+// Unwrappers recognises is not decoded itself; the nested calls are scanned
+// instead. Calldata longer than LargeSize (if set) goes through LargeDecoders
+// instead of Decoders, and its candidates must pass LargeValidators as well.
+// Contact information in messages is extracted unless SkipContacts is set.
+type Scanner struct {
+	Decoders     []Decoder
+	Validators   []Validator
+	Unwrappers   []Unwrapper
+	Selectors    map[string]string // Hex selectors (no 0x) of calls that are skipped
+	SkipContacts bool              // Leave Message.Contacts unset
+	Provenance   *Provenance       // Set on every Message, if not nil
+	ChainID      uint64            // Set on every Message
+
+	LargeSize       int
+	LargeDecoders   []Decoder
+	LargeValidators []Validator
+}
+
+// NewScanner returns a Scanner with the default UTF-8 and ENS record decoders,
+// the default heuristics, the Safe, ERC-4337 and batch (Multicall, MultiSend,
+// Disperse) unwrappers and the known selectors. Payloads above
+// DefaultLargeSize are streamed and held to LargeHeuristics.
+func NewScanner() *Scanner {
+	return &Scanner{
+		Decoders:   []Decoder{NewUTF8Decoder(DefaultMinLength), ENSDecoder{}},
+		Validators: []Validator{DefaultHeuristics},
+		Unwrappers: []Unwrapper{
+			SafeUnwrapper{},
+			UserOpUnwrapper{},
+			MulticallUnwrapper{},
+			MultiSendUnwrapper{},
+			DisperseUnwrapper{},
+		},
+		Selectors: maps.Clone(KnownSelectors),
+
+		LargeSize:       DefaultLargeSize,
+		LargeDecoders:   []Decoder{NewStreamDecoder(DefaultMinLength)},
+		LargeValidators: []Validator{LargeHeuristics},
+	}
+}
+
+// ScanBlock returns the messages in every transaction of block. It stops early,
+// returning what it has found so far, if ctx is cancelled.
+func (s *Scanner) ScanBlock(ctx context.Context, block *types.Block) []Message {
+	var msgs []Message
+	for _, tx := range block.Transactions() {
+		if ctx.Err() != nil {
+			break
+		}
+		for _, msg := range s.ScanTx(tx) {
+			msg.Block = block.NumberU64()
+			msg.Time = block.Time()
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// ScanTx returns the messages in a single transaction. Messages found in
+// nested calls are attributed to the nested call's sender and recipient.
+func (s *Scanner) ScanTx(tx *types.Transaction) []Message {
+	msgs := s.scan(Call{To: tx.To(), Value: tx.Value(), Data: tx.Data()}, 0, nil)
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	from, _ := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	for i := range msgs {
+		msgs[i].TxHash = tx.Hash()
+		if msgs[i].From == (common.Address{}) {
+			msgs[i].From = from
+		}
+	}
+	return msgs
+}
+
+// ScanData returns the messages in raw calldata. Only Text and Decoder are set,
+// except for messages in nested calls, which also get what is known of From, To
+// and Value.
+func (s *Scanner) ScanData(data []byte) []Message {
+	return s.ScanCall(Call{Data: data})
+}
+
+// ScanCall returns the messages in a call known only by its fields, e.g. one
+// read from another pipeline without the transaction. Knowing To lets wrapper
+// calls be unwrapped. TxHash, Block and Time are left for the caller to set.
+func (s *Scanner) ScanCall(call Call) []Message {
+	return s.scan(call, 0, nil)
+}
+
+// scan returns the messages in call, unwrapping nested calls up to
+// maxUnwrapDepth deep. Fields a nested call leaves unset are inherited from the
+// call enclosing it; a zero From is left for ScanTx to fill in.
+func (s *Scanner) scan(call Call, depth int, t *Trace) []Message {
+	if depth < maxUnwrapDepth {
+		var to common.Address
+		if call.To != nil {
+			to = *call.To
+		}
+		for _, u := range s.Unwrappers {
+			calls := u.Unwrap(to, call.Data)
+			if calls == nil {
+				continue
+			}
+			if t != nil {
+				t.Unwrapper = u.Name()
+			}
+			var msgs []Message
+			for _, c := range calls {
+				if c.From == (common.Address{}) {
+					c.From = call.From
+				}
+				if c.To == nil {
+					c.To = call.To
+				}
+				if c.Value == nil {
+					c.Value = call.Value
+				}
+				var nested *Trace
+				if t != nil {
+					nested = &Trace{Call: c}
+					t.Nested = append(t.Nested, nested)
+				}
+				for _, msg := range s.scan(c, depth+1, nested) {
+					msg.Decoder = u.Name() + "/" + msg.Decoder
+					msgs = append(msgs, msg)
+				}
+			}
+			return msgs
+		}
+	}
+
+	msgs := s.decode(call.Data, t)
+	for i := range msgs {
+		msgs[i].From, msgs[i].To, msgs[i].Value = call.From, call.To, call.Value
+	}
+	return msgs
+}
+
+// decode runs data through the decoders and validators, or the large-payload
+// ones if data is longer than LargeSize. A decoder that claims data runs alone.
+// If t isn't nil, each step is recorded in it.
+func (s *Scanner) decode(data []byte, t *Trace) []Message {
+	// Skip transactions with no data or known contract call signatures.
+	if len(data) == 0 || s.isContractCall(data) {
+		if t != nil {
+			t.Skipped = "no calldata"
+			if len(data) > 0 {
+				sig := hex.EncodeToString(data[:4])
+				t.Skipped = fmt.Sprintf("known selector 0x%s (%s)", sig, s.Selectors[sig])
+			}
+		}
+		return nil
+	}
+
+	decoders, large := s.Decoders, s.LargeSize > 0 && len(data) > s.LargeSize
+	if large {
+		decoders = s.LargeDecoders
+	}
+	for _, d := range decoders {
+		if c, ok := d.(Claimer); ok && c.Claims(data) {
+			decoders = []Decoder{d}
+			if t != nil {
+				t.Claimed = d.Name()
+			}
+			break
+		}
+	}
+	if t != nil {
+		t.Large = large
+	}
+	var msgs []Message
+	seen := make(map[string]bool)
+	for _, d := range decoders {
+		var dt *DecoderTrace
+		if t != nil {
+			t.Decoders = append(t.Decoders, DecoderTrace{Decoder: d.Name()})
+			dt = &t.Decoders[len(t.Decoders)-1]
+		}
+		if p, ok := d.(Prescanner); ok && !p.Prescan(data) {
+			if dt != nil {
+				dt.Prescanned = true
+			}
+			continue
+		}
+		for _, c := range candidates(d, data) {
+			var ct *CandidateTrace
+			if dt != nil {
+				dt.Candidates = append(dt.Candidates, CandidateTrace{Text: c.Text, Duplicate: seen[c.Text]})
+				ct = &dt.Candidates[len(dt.Candidates)-1]
+			}
+			if seen[c.Text] || !s.valid(c.Text, large, ct) {
+				continue
+			}
+			seen[c.Text] = true
+			if ct != nil {
+				ct.Accepted = true
+			}
+			msg := Message{Text: c.Text, Decoder: d.Name(), Before: c.Before, After: c.After,
+				Entities: ExtractEntities(c.Text), Fingerprint: FingerprintText(c.Text), Provenance: s.Provenance,
+				ChainID: s.ChainID}
+			if !s.SkipContacts {
+				msg.Contacts = ExtractContacts(c.Text)
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// candidates returns d's candidates in data, with context if d reports it.
+func candidates(d Decoder, data []byte) []Candidate {
+	if cd, ok := d.(ContextDecoder); ok {
+		return cd.DecodeContext(data)
+	}
+	var cs []Candidate
+	for _, text := range d.Decode(data) {
+		cs = append(cs, Candidate{Text: text})
+	}
+	return cs
+}
+
+// valid reports whether candidate passes every validator, and every
+// large-payload validator if large is set. If ct isn't nil, every validator
+// runs and its verdict is recorded in ct; otherwise valid stops at the first
+// failure.
+func (s *Scanner) valid(candidate string, large bool, ct *CandidateTrace) bool {
+	ok := runValidators(s.Validators, candidate, ct)
+	if large && (ok || ct != nil) {
+		ok = runValidators(s.LargeValidators, candidate, ct) && ok
+	}
+	return ok
+}
+
+// runValidators runs validators over candidate for valid.
+func runValidators(validators []Validator, candidate string, ct *CandidateTrace) bool {
+	ok := true
+	for _, v := range validators {
+		passed := v.Valid(candidate)
+		if ct == nil {
+			if !passed {
+				return false
+			}
+			continue
+		}
+		check := Check{Validator: fmt.Sprintf("%T", v), Passed: passed}
+		if e, isExplainer := v.(Explainer); isExplainer {
+			check.Detail = e.Explain(candidate)
+		}
+		ct.Checks = append(ct.Checks, check)
+		ok = ok && passed
+	}
+	return ok
+}
+
+// isContractCall checks if the first 4 bytes of data match a known function signature.
+func (s *Scanner) isContractCall(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	sig := hex.EncodeToString(data[:4])
+	_, exists := s.Selectors[sig]
+	return exists
+}
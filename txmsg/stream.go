@@ -0,0 +1,106 @@
+package txmsg
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// DefaultLargeSize is the calldata size above which NewScanner routes payloads
+// to the large-payload decoders and validators.
+const DefaultLargeSize = 32 << 10
+
+// maxStreamRun caps the text run StreamDecoder decodes at once, bounding its
+// buffer however long the payload is.
+const maxStreamRun = 4 << 10
+
+// LargeHeuristics are the stricter thresholds NewScanner applies, on top of
+// the regular validators, to payloads above DefaultLargeSize. Inscription-era
+// megabyte calldata is full of short text fragments that pass the defaults.
+var LargeHeuristics = Heuristics{
+	MinWords:      4,
+	MinWordLength: 3,
+	LetterRatio:   0.75,
+}
+
+// StreamDecoder is the decoder for very large calldata. Rather than decoding
+// the whole payload into one buffer and running the regex over it, it walks
+// the payload once, splitting it into runs at bytes that aren't valid UTF-8
+// and decoding each run that passes the prescan on its own.
+type StreamDecoder struct {
+	pattern   *regexp.Regexp
+	minLength int
+}
+
+// NewStreamDecoder returns a StreamDecoder matching runs of at least minLength runes.
+func NewStreamDecoder(minLength int) *StreamDecoder {
+	pattern := regexp.MustCompile(CandidateExpr(minLength))
+	pattern.Longest()
+	return &StreamDecoder{pattern: pattern, minLength: minLength}
+}
+
+// Name implements Decoder.
+func (d *StreamDecoder) Name() string { return "utf8-stream" }
+
+// String returns the candidate pattern, which holds the minimum length.
+func (d *StreamDecoder) String() string { return d.pattern.String() }
+
+// Prescan implements Prescanner. Calldata that passes is still prescanned run
+// by run as it is decoded.
+func (d *StreamDecoder) Prescan(data []byte) bool { return hasCandidateRun(data, d.minLength) }
+
+// Decode implements Decoder.
+func (d *StreamDecoder) Decode(data []byte) []string {
+	var texts []string
+	for _, c := range d.DecodeContext(data) {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+// DecodeContext implements ContextDecoder. The context never extends past the
+// run of text a candidate was found in.
+func (d *StreamDecoder) DecodeContext(data []byte) []Candidate {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	var candidates []Candidate
+	for len(data) > 0 {
+		// Find the next run of UTF-8, up to maxStreamRun long.
+		n := 0
+		for n < len(data) && n < maxStreamRun {
+			size := textRune(data[n:])
+			if size == 0 {
+				break
+			}
+			n += size
+		}
+		if n == 0 {
+			data = data[1:]
+			continue
+		}
+		run := data[:n]
+		data = data[n:]
+		if !hasCandidateRun(run, d.minLength) {
+			continue
+		}
+
+		buf.Reset()
+		decodeUTF8(buf, run)
+		candidates = appendCandidates(candidates, d.pattern, buf.Bytes())
+	}
+	return candidates
+}
+
+// textRune returns the size of the UTF-8 rune at the start of data: 1 for any
+// ASCII byte, including the control bytes decodeUTF8 drops so that text
+// interleaved with them (UTF-16, NUL padding) stays in one run, or the size of
+// a valid multi-byte rune. It returns 0 for invalid bytes.
+func textRune(data []byte) int {
+	if data[0] < utf8.RuneSelf {
+		return 1
+	}
+	if r, n := utf8.DecodeRune(data); r != utf8.RuneError {
+		return n
+	}
+	return 0
+}
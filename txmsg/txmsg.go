@@ -0,0 +1,97 @@
+// Package txmsg finds human-readable messages embedded in Ethereum transaction
+// calldata. A Scanner runs calldata through a pipeline of Decoders, which turn
+// raw bytes into candidate strings, and Validators, which decide whether a
+// candidate looks like a real message. Both are interfaces so that callers can
+// plug in their own heuristics. Unwrappers open up calls to wrapper contracts,
+// such as multisigs, so that the calls nested inside are scanned as well.
+package txmsg
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Message is a message found in a transaction's calldata.
+type Message struct {
+	TxHash  common.Hash     `json:"txHash"`
+	ChainID uint64          `json:"chainId,omitempty"` // Chain the tx is on, zero if unknown
+	Block   uint64          `json:"block"`             // Block number, zero when the tx was scanned on its own
+	Time    uint64          `json:"time"`              // Block timestamp, zero when the tx was scanned on its own
+	From    common.Address  `json:"from"`              // Sender, zero if the signature couldn't be recovered
+	To      *common.Address `json:"to"`                // Recipient, nil for contract creation
+	Value   *big.Int        `json:"value"`             // Wei transferred with the message
+	Text    string          `json:"text"`              // The decoded message
+	Decoder string          `json:"decoder"`           // Name of the decoder that produced Text
+	Before  string          `json:"before,omitempty"`  // Decoded text just before Text, if the decoder reports it
+	After   string          `json:"after,omitempty"`   // Decoded text just after Text
+
+	Contacts *Contacts `json:"contacts,omitempty"` // Contact information in Text, unless the scanner skips it
+	Entities []Entity  `json:"entities,omitempty"` // Dates, coordinates, addresses, tx hashes and amounts quoted in Text
+
+	Fingerprint Fingerprint  `json:"fingerprint,omitempty"` // Simhash of Text
+	FirstWriter *Attribution `json:"firstWriter,omitempty"` // Earliest stored copy of Text, if the store was asked
+
+	Provenance *Provenance `json:"provenance,omitempty"` // How the message was found, if the scanner recorded it
+}
+
+// Decoder extracts candidate messages from raw calldata.
+type Decoder interface {
+	// Name identifies the decoder in Message.Decoder.
+	Name() string
+	// Decode returns the candidate strings found in data.
+	Decode(data []byte) []string
+}
+
+// Candidate is a candidate message with up to ContextSize bytes of the decoded
+// text around it, which shows whether a detection was cut short.
+type Candidate struct {
+	Text, Before, After string
+}
+
+// ContextDecoder is a Decoder that can also report the text around each
+// candidate. The Scanner prefers DecodeContext when a decoder has it.
+type ContextDecoder interface {
+	Decoder
+	DecodeContext(data []byte) []Candidate
+}
+
+// Prescanner is a Decoder with a cheap check that rules out calldata it
+// can't find candidates in. The Scanner runs Prescan first and only decodes
+// calldata it passes.
+type Prescanner interface {
+	Decoder
+	Prescan(data []byte) bool
+}
+
+// Claimer is a Decoder for calls of a known shape, such as a record setter,
+// whose arguments would also be picked up as text by the generic decoders.
+// Calldata it claims is decoded by it alone.
+type Claimer interface {
+	Decoder
+	Claims(data []byte) bool
+}
+
+// Validator decides whether a candidate string is a real message.
+type Validator interface {
+	Valid(candidate string) bool
+}
+
+// Call is a call nested inside another call's calldata. From, To and Value
+// are inherited from the enclosing call when left unset.
+type Call struct {
+	From  common.Address  // Account making the call, e.g. the multisig executing it
+	To    *common.Address // Called contract
+	Value *big.Int        // Wei sent with the call
+	Data  []byte
+}
+
+// Unwrapper extracts the calls nested in a call to a wrapper contract.
+type Unwrapper interface {
+	// Name identifies the unwrapper; it prefixes Message.Decoder of messages
+	// found in nested calls, as in "safe/utf8".
+	Name() string
+	// Unwrap returns the calls nested in a call with the given calldata to the
+	// contract at to, or nil if data isn't a call it knows.
+	Unwrap(to common.Address, data []byte) []Call
+}
@@ -0,0 +1,442 @@
+package txmsg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	safeAddr   = common.HexToAddress("0x5afe5afe5afe5afe5afe5afe5afe5afe5afe5afe")
+	targetAddr = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	otherAddr  = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	routerAddr = common.HexToAddress("0xca11bde05977b3631167028862be2a173976ca11")
+)
+
+// Tuple types of the wrapper functions, laid out for the ABI encoder.
+type (
+	userOpV6 struct {
+		Sender               common.Address
+		Nonce                *big.Int
+		InitCode             []byte
+		CallData             []byte
+		CallGasLimit         *big.Int
+		VerificationGasLimit *big.Int
+		PreVerificationGas   *big.Int
+		MaxFeePerGas         *big.Int
+		MaxPriorityFeePerGas *big.Int
+		PaymasterAndData     []byte
+		Signature            []byte
+	}
+	userOpV7 struct {
+		Sender             common.Address
+		Nonce              *big.Int
+		InitCode           []byte
+		CallData           []byte
+		AccountGasLimits   [32]byte
+		PreVerificationGas *big.Int
+		GasFees            [32]byte
+		PaymasterAndData   []byte
+		Signature          []byte
+	}
+	call struct {
+		Target   common.Address
+		CallData []byte
+	}
+	call3 struct {
+		Target       common.Address
+		AllowFailure bool
+		CallData     []byte
+	}
+	call3Value struct {
+		Target       common.Address
+		AllowFailure bool
+		Value        *big.Int
+		CallData     []byte
+	}
+)
+
+// Input lists of the wrapper functions, in ABI JSON.
+const (
+	callTuple       = `{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"callData","type":"bytes"}]}`
+	call3Tuple      = `{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}`
+	call3ValueTuple = `{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"value","type":"uint256"},{"name":"callData","type":"bytes"}]}`
+	userOpV6Tuple   = `{"name":"ops","type":"tuple[]","components":[{"name":"sender","type":"address"},{"name":"nonce","type":"uint256"},{"name":"initCode","type":"bytes"},{"name":"callData","type":"bytes"},{"name":"callGasLimit","type":"uint256"},{"name":"verificationGasLimit","type":"uint256"},{"name":"preVerificationGas","type":"uint256"},{"name":"maxFeePerGas","type":"uint256"},{"name":"maxPriorityFeePerGas","type":"uint256"},{"name":"paymasterAndData","type":"bytes"},{"name":"signature","type":"bytes"}]}`
+	userOpV7Tuple   = `{"name":"ops","type":"tuple[]","components":[{"name":"sender","type":"address"},{"name":"nonce","type":"uint256"},{"name":"initCode","type":"bytes"},{"name":"callData","type":"bytes"},{"name":"accountGasLimits","type":"bytes32"},{"name":"preVerificationGas","type":"uint256"},{"name":"gasFees","type":"bytes32"},{"name":"paymasterAndData","type":"bytes"},{"name":"signature","type":"bytes"}]}`
+)
+
+// encode returns the calldata of a call to name, whose inputs are given in
+// ABI JSON, with args, as the canonical ABI encoder packs it.
+func encode(t *testing.T, name, inputs string, args ...any) []byte {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(fmt.Sprintf(`[{"type":"function","name":%q,"inputs":[%s]}]`, name, inputs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Pack(name, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// arg returns ABI JSON for an argument.
+func arg(name, typ string) string {
+	return fmt.Sprintf(`{"name":%q,"type":%q}`, name, typ)
+}
+
+// args joins argument declarations.
+func args(decls ...string) string {
+	return strings.Join(decls, ",")
+}
+
+// callString describes c for comparisons.
+func callString(c Call) string {
+	to, value := "nil", "nil"
+	if c.To != nil {
+		to = c.To.Hex()
+	}
+	if c.Value != nil {
+		value = c.Value.String()
+	}
+	return fmt.Sprintf("from %s to %s value %s data %x", c.From.Hex(), to, value, c.Data)
+}
+
+// packMultiSend packs transactions as MultiSend expects them.
+func packMultiSend(calls ...Call) []byte {
+	var packed []byte
+	for _, c := range calls {
+		packed = append(packed, 0)
+		packed = append(packed, c.To.Bytes()...)
+		packed = append(packed, common.LeftPadBytes(c.Value.Bytes(), 32)...)
+		packed = append(packed, common.LeftPadBytes(big.NewInt(int64(len(c.Data))).Bytes(), 32)...)
+		packed = append(packed, c.Data...)
+	}
+	return packed
+}
+
+func TestSelectors(t *testing.T) {
+	for selector, sig := range map[string]string{
+		execTransactionSelector:      "execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)",
+		handleOpsV6Selector:          "handleOps((address,uint256,bytes,bytes,uint256,uint256,uint256,uint256,uint256,bytes,bytes)[],address)",
+		handleOpsV7Selector:          "handleOps((address,uint256,bytes,bytes,bytes32,uint256,bytes32,bytes,bytes)[],address)",
+		aggregateSelector:            "aggregate((address,bytes)[])",
+		blockAndAggregateSelector:    "blockAndAggregate((address,bytes)[])",
+		tryAggregateSelector:         "tryAggregate(bool,(address,bytes)[])",
+		tryBlockAndAggregateSelector: "tryBlockAndAggregate(bool,(address,bytes)[])",
+		aggregate3Selector:           "aggregate3((address,bool,bytes)[])",
+		aggregate3ValueSelector:      "aggregate3Value((address,bool,uint256,bytes)[])",
+		multicallSelector:            "multicall(bytes[])",
+		multicallDeadlineSelector:    "multicall(uint256,bytes[])",
+		multiSendSelector:            "multiSend(bytes)",
+		disperseEtherSelector:        "disperseEther(address[],uint256[])",
+		disperseTokenSelector:        "disperseToken(address,address[],uint256[])",
+		disperseTokenSimpleSelector:  "disperseTokenSimple(address,address[],uint256[])",
+	} {
+		if got := hex.EncodeToString(crypto.Keccak256([]byte(sig))[:4]); got != selector {
+			t.Errorf("selector of %s = %s, have %s", sig, got, selector)
+		}
+	}
+}
+
+// unwrapCase is calldata for an unwrapper and the calls it should find.
+type unwrapCase struct {
+	name string
+	u    Unwrapper
+	to   common.Address
+	data []byte
+	want []Call
+}
+
+// unwrapCases returns well-formed calldata for every unwrapper.
+func unwrapCases(t *testing.T) []unwrapCase {
+	inner := []byte("gm, this is the inner message")
+	other := []byte("and another one, friend")
+	sigs := append(make([]byte, 65), []byte("signed with love")...)
+	zero := new(big.Int)
+	value := big.NewInt(1e18)
+	appended := []byte("thanks for all the help")
+
+	disperseEther := encode(t, "disperseEther", args(arg("recipients", "address[]"), arg("values", "uint256[]")),
+		[]common.Address{targetAddr, otherAddr}, []*big.Int{value, value})
+	disperseToken := encode(t, "disperseToken", args(arg("token", "address"), arg("recipients", "address[]"), arg("values", "uint256[]")),
+		routerAddr, []common.Address{targetAddr}, []*big.Int{value})
+
+	return []unwrapCase{
+		{
+			name: "safe execTransaction",
+			u:    SafeUnwrapper{},
+			to:   safeAddr,
+			data: encode(t, "execTransaction", args(arg("to", "address"), arg("value", "uint256"), arg("data", "bytes"),
+				arg("operation", "uint8"), arg("safeTxGas", "uint256"), arg("baseGas", "uint256"), arg("gasPrice", "uint256"),
+				arg("gasToken", "address"), arg("refundReceiver", "address"), arg("signatures", "bytes")),
+				targetAddr, value, inner, uint8(0), zero, zero, zero, common.Address{}, common.Address{}, sigs),
+			want: []Call{
+				{From: safeAddr, To: &targetAddr, Value: value, Data: inner},
+				{From: safeAddr, To: &safeAddr, Value: zero, Data: sigs},
+			},
+		},
+		{
+			name: "handleOps v0.6",
+			u:    UserOpUnwrapper{},
+			data: encode(t, "handleOps", args(userOpV6Tuple, arg("beneficiary", "address")), []userOpV6{
+				{Sender: targetAddr, Nonce: zero, CallData: inner, CallGasLimit: zero, VerificationGasLimit: zero,
+					PreVerificationGas: zero, MaxFeePerGas: zero, MaxPriorityFeePerGas: zero, Signature: sigs},
+				{Sender: otherAddr, Nonce: big.NewInt(7), InitCode: []byte{1, 2}, CallData: other, CallGasLimit: zero,
+					VerificationGasLimit: zero, PreVerificationGas: zero, MaxFeePerGas: zero, MaxPriorityFeePerGas: zero},
+			}, routerAddr),
+			want: []Call{
+				{From: targetAddr, To: &targetAddr, Value: zero, Data: inner},
+				{From: otherAddr, To: &otherAddr, Value: zero, Data: other},
+			},
+		},
+		{
+			name: "handleOps v0.7",
+			u:    UserOpUnwrapper{},
+			data: encode(t, "handleOps", args(userOpV7Tuple, arg("beneficiary", "address")), []userOpV7{
+				{Sender: targetAddr, Nonce: zero, CallData: inner, PreVerificationGas: zero, PaymasterAndData: []byte{9}},
+			}, routerAddr),
+			want: []Call{{From: targetAddr, To: &targetAddr, Value: zero, Data: inner}},
+		},
+		{
+			name: "aggregate",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "aggregate", callTuple, []call{{targetAddr, inner}, {otherAddr, other}}),
+			want: []Call{
+				{From: routerAddr, To: &targetAddr, Value: zero, Data: inner},
+				{From: routerAddr, To: &otherAddr, Value: zero, Data: other},
+			},
+		},
+		{
+			name: "blockAndAggregate",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "blockAndAggregate", callTuple, []call{{targetAddr, inner}}),
+			want: []Call{{From: routerAddr, To: &targetAddr, Value: zero, Data: inner}},
+		},
+		{
+			name: "tryAggregate",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "tryAggregate", args(arg("requireSuccess", "bool"), callTuple), true, []call{{targetAddr, inner}}),
+			want: []Call{{From: routerAddr, To: &targetAddr, Value: zero, Data: inner}},
+		},
+		{
+			name: "tryBlockAndAggregate",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "tryBlockAndAggregate", args(arg("requireSuccess", "bool"), callTuple), false, []call{{otherAddr, other}}),
+			want: []Call{{From: routerAddr, To: &otherAddr, Value: zero, Data: other}},
+		},
+		{
+			name: "aggregate3",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "aggregate3", call3Tuple, []call3{{targetAddr, true, inner}, {otherAddr, false, nil}}),
+			want: []Call{
+				{From: routerAddr, To: &targetAddr, Value: zero, Data: inner},
+				{From: routerAddr, To: &otherAddr, Value: zero, Data: nil},
+			},
+		},
+		{
+			name: "aggregate3Value",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "aggregate3Value", call3ValueTuple, []call3Value{{targetAddr, false, value, inner}}),
+			want: []Call{{From: routerAddr, To: &targetAddr, Value: value, Data: inner}},
+		},
+		{
+			name: "multicall",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "multicall", arg("data", "bytes[]"), [][]byte{inner, other}),
+			want: []Call{{To: &routerAddr, Data: inner}, {To: &routerAddr, Data: other}},
+		},
+		{
+			name: "multicall with deadline",
+			u:    MulticallUnwrapper{},
+			to:   routerAddr,
+			data: encode(t, "multicall", args(arg("deadline", "uint256"), arg("data", "bytes[]")), big.NewInt(1700000000), [][]byte{inner}),
+			want: []Call{{To: &routerAddr, Data: inner}},
+		},
+		{
+			name: "multiSend",
+			u:    MultiSendUnwrapper{},
+			to:   safeAddr,
+			data: encode(t, "multiSend", arg("transactions", "bytes"), packMultiSend(
+				Call{To: &targetAddr, Value: value, Data: inner},
+				Call{To: &otherAddr, Value: zero, Data: nil},
+			)),
+			want: []Call{{To: &targetAddr, Value: value, Data: inner}, {To: &otherAddr, Value: zero, Data: nil}},
+		},
+		{
+			name: "disperseEther with appended text",
+			u:    DisperseUnwrapper{},
+			data: append(disperseEther, appended...),
+			want: []Call{{Data: appended}},
+		},
+		{
+			name: "disperseEther",
+			u:    DisperseUnwrapper{},
+			data: disperseEther,
+			want: []Call{{Data: nil}},
+		},
+		{
+			name: "disperseToken with appended text",
+			u:    DisperseUnwrapper{},
+			data: append(disperseToken, appended...),
+			want: []Call{{Data: appended}},
+		},
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	for _, tt := range unwrapCases(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.u.Unwrap(tt.to, tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Unwrap returned %d calls, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if g, w := callString(got[i]), callString(tt.want[i]); g != w {
+					t.Errorf("call %d:\n got %s\nwant %s", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestUnwrapOtherCalls(t *testing.T) {
+	unwrappers := []Unwrapper{SafeUnwrapper{}, UserOpUnwrapper{}, MulticallUnwrapper{}, MultiSendUnwrapper{}, DisperseUnwrapper{}}
+	transfer := encode(t, "transfer", args(arg("to", "address"), arg("amount", "uint256")), targetAddr, big.NewInt(5))
+	for _, data := range [][]byte{nil, {0x6a}, []byte("hello there my friend"), transfer} {
+		for _, u := range unwrappers {
+			if calls := u.Unwrap(routerAddr, data); calls != nil {
+				t.Errorf("%s unwrapped %x into %d calls", u.Name(), data, len(calls))
+			}
+		}
+	}
+}
+
+// TestUnwrapTruncated cuts every case short at every length. Nothing may
+// panic, and a truncated payload may only yield calls that the whole payload
+// yields too: a Safe transaction without its signatures still has its inner
+// call, but no call may come out garbled.
+func TestUnwrapTruncated(t *testing.T) {
+	for _, tt := range unwrapCases(t) {
+		if _, ok := tt.u.(DisperseUnwrapper); ok {
+			continue // anything after the arrays is appended data
+		}
+		for n := 0; n < len(tt.data); n++ {
+			calls := tt.u.Unwrap(tt.to, tt.data[:n])
+			if len(calls) > len(tt.want) {
+				t.Errorf("%s cut to %d of %d bytes: unwrapped %d calls", tt.name, n, len(tt.data), len(calls))
+				continue
+			}
+			for i := range calls {
+				if g, w := callString(calls[i]), callString(tt.want[i]); g != w {
+					t.Errorf("%s cut to %d of %d bytes, call %d:\n got %s\nwant %s", tt.name, n, len(tt.data), i, g, w)
+				}
+			}
+		}
+	}
+}
+
+// TestUnwrapBadOffsets points the offsets and lengths of each case outside
+// the payload, or off word boundaries.
+func TestUnwrapBadOffsets(t *testing.T) {
+	huge := common.MaxHash.Bytes()
+	for _, tt := range unwrapCases(t) {
+		if _, ok := tt.u.(DisperseUnwrapper); ok {
+			continue
+		}
+		args := tt.data[4:]
+		for w := 0; w*abiWord < len(args); w++ {
+			word := args[w*abiWord : (w+1)*abiWord]
+			v := new(big.Int).SetBytes(word)
+			if !v.IsInt64() || v.Int64() == 0 || v.Int64() > int64(len(args)) {
+				continue // not an offset or a length
+			}
+			for _, bad := range [][]byte{
+				huge,
+				common.LeftPadBytes(big.NewInt(int64(len(args))+abiWord).Bytes(), abiWord),
+				common.LeftPadBytes(big.NewInt(v.Int64()+1).Bytes(), abiWord),
+			} {
+				data := append([]byte{}, tt.data...)
+				copy(data[4+w*abiWord:], bad)
+				calls := tt.u.Unwrap(tt.to, data) // must not panic
+				for _, c := range calls {
+					if len(c.Data) > len(data) {
+						t.Errorf("%s with word %d set to %x: call data longer than the payload", tt.name, w, bad)
+					}
+				}
+			}
+			data := append([]byte{}, tt.data...)
+			copy(data[4+w*abiWord:], huge)
+			if calls := tt.u.Unwrap(tt.to, data); calls != nil && isOffset(tt, w) {
+				t.Errorf("%s with offset word %d out of bounds: unwrapped %d calls", tt.name, w, len(calls))
+			}
+		}
+	}
+}
+
+// isOffset reports whether word w of a case's arguments is the offset of its
+// first dynamic argument, which every unwrapper needs.
+func isOffset(tt unwrapCase, w int) bool {
+	args := tt.data[4:]
+	for i := 0; i*abiWord < len(args); i++ {
+		v := new(big.Int).SetBytes(args[i*abiWord : (i+1)*abiWord])
+		if v.IsInt64() && v.Int64() > 0 && v.Int64()%abiWord == 0 && v.Int64() < int64(len(args)) {
+			return i == w
+		}
+	}
+	return false
+}
+
+func TestMultiSendBadLength(t *testing.T) {
+	value := big.NewInt(1)
+	packed := packMultiSend(Call{To: &targetAddr, Value: value, Data: []byte("hello there")})
+	copy(packed[53:85], common.MaxHash.Bytes())
+	data := encode(t, "multiSend", arg("transactions", "bytes"), packed)
+	if calls := (MultiSendUnwrapper{}).Unwrap(safeAddr, data); calls != nil {
+		t.Errorf("unwrapped %d calls with an inner length past the payload", len(calls))
+	}
+}
+
+// TestUnwrapMutated flips random bytes of each case; the scanner must never
+// panic on what comes out.
+func TestUnwrapMutated(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := NewScanner()
+	for _, tt := range unwrapCases(t) {
+		for range 500 {
+			data := append([]byte{}, tt.data...)
+			for range 1 + rng.Intn(4) {
+				data[4+rng.Intn(len(data)-4)] = byte(rng.Intn(256))
+			}
+			to := tt.to
+			s.ScanCall(Call{To: &to, Data: data})
+		}
+	}
+}
+
+func TestScanNestedMessages(t *testing.T) {
+	s := NewScanner()
+	for _, tt := range unwrapCases(t) {
+		to := tt.to
+		msgs := s.ScanCall(Call{From: otherAddr, To: &to, Data: tt.data})
+		for _, msg := range msgs {
+			if !strings.HasPrefix(msg.Decoder, tt.u.Name()+"/") {
+				t.Errorf("%s: message %q has decoder %q", tt.name, msg.Text, msg.Decoder)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package txmsg
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EntryPoint handleOps for EntryPoint v0.6 (unpacked gas fields) and v0.7
+// (packed). In both, a UserOperation starts with sender, nonce, initCode and
+// callData.
+const (
+	handleOpsV6Selector = "1fad948c"
+	handleOpsV7Selector = "765e827f"
+)
+
+// UserOpUnwrapper opens up ERC-4337 bundler transactions calling an
+// EntryPoint's handleOps. Each UserOperation's callData is executed by its
+// smart account, so messages in it are attributed to the account rather than
+// to the bundler that sent the transaction.
+type UserOpUnwrapper struct{}
+
+// Name implements Unwrapper.
+func (UserOpUnwrapper) Name() string { return "userop" }
+
+// Unwrap implements Unwrapper.
+func (UserOpUnwrapper) Unwrap(_ common.Address, data []byte) []Call {
+	args, ok := abiArgs(data, handleOpsV6Selector)
+	if !ok {
+		if args, ok = abiArgs(data, handleOpsV7Selector); !ok {
+			return nil
+		}
+	}
+	ops, ok := abiDynamicArray(args, 0)
+	if !ok {
+		return nil
+	}
+	calls := make([]Call, 0, len(ops))
+	for _, op := range ops {
+		sender, ok1 := abiAddress(op, 0)
+		callData, ok2 := abiBytes(op, 3)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		calls = append(calls, Call{From: sender, To: &sender, Value: new(big.Int), Data: callData})
+	}
+	return calls
+}
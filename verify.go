@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// runVerify re-fetches a random sample of completed tasks and checks that their
+// block hashes still match the recorded digest. Matching tasks are marked
+// verified; mismatches are marked failed so that repair rescans them.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	chainOpts := addChainFlags(fs, "mainnet")
+	sample := fs.Int("sample", 5, "number of completed tasks to re-check")
+	rate := fs.Float64("rate", defaultRate, "maximum RPC requests per second")
+	parseFlags(fs, args)
+
+	if !(*rate > 0) {
+		fatalf(exitUsage, "-rate must be positive")
+	}
+
+	m, err := loadManifest(chainOpts.lookup().file(manifestFile))
+	if err != nil {
+		fatalf(exitFailure, "Manifest error: %v", err)
+	}
+
+	var completed []*task
+	for _, t := range m.sorted() {
+		if t.State == taskDone || t.State == taskVerified {
+			completed = append(completed, t)
+		}
+	}
+	rand.Shuffle(len(completed), func(i, j int) { completed[i], completed[j] = completed[j], completed[i] })
+	if len(completed) > *sample {
+		completed = completed[:*sample]
+	}
+
+	client := chainOpts.resolve().dial()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	limiter := newRateLimiter(ctx, *rate, 1)
+	for _, t := range completed {
+		digest, err := fetchDigest(ctx, client, limiter, t)
+		if err != nil {
+			log.Printf("Task %d-%d verify error: %v", t.Start, t.End, err)
+			continue
+		}
+		if digest == t.Digest {
+			t.State = taskVerified
+		} else {
+			log.Printf("Task %d-%d digest mismatch, marking failed for repair", t.Start, t.End)
+			t.State = taskFailed
+		}
+	}
+	if err := m.save(); err != nil {
+		fatalf(exitFailure, "Manifest save error: %v", err)
+	}
+
+	counts := m.count()
+	fmt.Printf("Checked %d tasks: %d pending, %d done, %d failed, %d verified\n", len(completed),
+		counts[taskPending], counts[taskDone], counts[taskFailed], counts[taskVerified])
+	for _, t := range m.sorted() {
+		if t.State == taskFailed {
+			fmt.Printf("  failed: blocks %d-%d\n", t.Start, t.End)
+		}
+	}
+}
+
+// headerFetcher is the part of ethclient.Client verify needs.
+type headerFetcher interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// fetchDigest recomputes a task's digest from the block headers on chain.
+func fetchDigest(ctx context.Context, client headerFetcher, limiter *rateLimiter, t *task) (string, error) {
+	var hashes []common.Hash
+	for blockNum := t.End; blockNum >= t.Start; blockNum-- {
+		if err := limiter.wait(ctx); err != nil {
+			return "", err
+		}
+		num := getBlockNumber(blockNum)
+		header, err := client.HeaderByNumber(ctx, num)
+		putBlockNumber(num)
+		if err != nil {
+			return "", fmt.Errorf("block %d: %w", blockNum, err)
+		}
+		hashes = append(hashes, header.Hash())
+	}
+	return rangeDigest(hashes), nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/krbreyn/txmsg-r/store"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// watchedBlock is a recently processed block on the canonical chain.
+type watchedBlock struct {
+	hash  common.Hash
+	time  uint64
+	found []txmsg.Message
+}
+
+// headReader is the part of ethclient.Client the watcher needs to walk a branch.
+type headReader interface {
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+}
+
+// watcher follows the chain head. It remembers the last reorgDepth blocks so
+// that when the head switches branches it can retract the messages of blocks
+// that were reorged out and emit those of the new branch.
+type watcher struct {
+	chain    *Chain
+	scanner  *txmsg.Scanner
+	store    *store.Buffered
+	maxSkew  time.Duration
+	keywords []string // Only messages mentioning one are printed, if set
+	blocks   map[uint64]*watchedBlock
+	tip      uint64
+	ready    bool             // READY=1 has been sent to systemd
+	watchdog <-chan time.Time // Ticks when a systemd watchdog ping is due; nil if disabled
+
+	lease  time.Duration // Leader lease term; 0 if every watcher writes
+	holder string        // This watcher's name in the lease table
+	leader bool          // Holds the lease
+}
+
+// runWatch subscribes to new heads and prints and stores messages as blocks
+// arrive, until ctx is cancelled; dropped connections are retried with
+// exponential backoff. Block timestamps further than maxSkew ahead of the local clock or
+// behind their parent are flagged. Only messages mentioning one of keywords are
+// printed, if any are given; all are stored. Under systemd (Type=notify), it
+// reports readiness once subscribed and pings the watchdog while responsive.
+// With a non-zero lease, watchers sharing the store elect a leader and only it
+// prints and stores messages (see checkLease).
+func runWatch(ctx context.Context, chain *Chain, scanner *txmsg.Scanner, st *store.Buffered, maxSkew time.Duration,
+	keywords []string, lease time.Duration) {
+	w := &watcher{
+		chain:    chain,
+		scanner:  scanner,
+		store:    st,
+		maxSkew:  maxSkew,
+		keywords: keywords,
+		blocks:   make(map[uint64]*watchedBlock),
+		lease:    lease,
+		holder:   leaseHolder(),
+	}
+	if interval := watchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		w.watchdog = ticker.C
+	}
+
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := w.follow(ctx)
+		if ctx.Err() != nil {
+			log.Printf("Stopping")
+			w.notify("STOPPING=1")
+			return
+		}
+		// A connection that stayed up for a while earns a fresh backoff.
+		if time.Since(start) > maxReconnect {
+			backoff = time.Second
+		}
+		log.Printf("Watch error: %v (reconnecting in %s)", err, backoff)
+		w.notify(fmt.Sprintf("STATUS=Reconnecting in %s: %v", backoff, err))
+		w.sleep(ctx, backoff)
+		backoff = min(backoff*2, maxReconnect)
+	}
+}
+
+// follow connects to the chain and handles new heads until the subscription
+// fails. If the chain has a block time hint, a subscription that goes quiet for
+// stallBlocks block times is treated as failed.
+func (w *watcher) follow(ctx context.Context) error {
+	client, err := ethclient.DialContext(ctx, w.chain.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := w.chain.checkID(ctx, client); err != nil {
+		return err
+	}
+
+	heads := make(chan *types.Header)
+	sub, err := client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	if !w.ready {
+		w.notify("READY=1")
+		w.ready = true
+	}
+	w.notify("STATUS=Following " + w.chain.Name)
+
+	// A nil renew channel never fires, so without a lease nothing is renewed.
+	var renew <-chan time.Time
+	if w.lease > 0 {
+		ticker := time.NewTicker(w.lease / 3)
+		defer ticker.Stop()
+		renew = ticker.C
+		if w.checkLease(ctx); !w.leader {
+			log.Printf("Standing by: another watcher holds the lease")
+		}
+	}
+
+	// A nil stalled channel never fires, so chains without a hint wait forever.
+	var stalled <-chan time.Time
+	var timer *time.Timer
+	stallAfter := stallBlocks * time.Duration(w.chain.BlockTime)
+	if stallAfter > 0 {
+		timer = time.NewTimer(stallAfter)
+		defer timer.Stop()
+		stalled = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case <-stalled:
+			return fmt.Errorf("no new head in %s", stallAfter)
+		case <-w.watchdog:
+			w.notify("WATCHDOG=1")
+		case <-renew:
+			w.checkLease(ctx)
+		case head := <-heads:
+			if timer != nil {
+				timer.Reset(stallAfter)
+			}
+			if w.lease > 0 {
+				if !w.leader {
+					continue // standing by
+				}
+				if len(w.blocks) == 0 {
+					if err := w.catchUp(ctx, client, head.Number.Uint64()); err != nil {
+						return err
+					}
+				}
+			}
+			if err := w.handleHead(ctx, client, head); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done, pinging the watchdog meanwhile.
+func (w *watcher) sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		case <-w.watchdog:
+			w.notify("WATCHDOG=1")
+		}
+	}
+}
+
+// notify sends state to systemd, logging failures.
+func (w *watcher) notify(state string) {
+	if err := sdNotify(state); err != nil {
+		log.Printf("Notify error: %v", err)
+	}
+}
+
+// handleHead brings the watcher's view of the chain up to head. It walks back
+// from head through parent hashes until it reaches a block it already holds,
+// which fills gaps left by missed heads and finds the fork point of a reorg.
+func (w *watcher) handleHead(ctx context.Context, client headReader, head *types.Header) error {
+	var branch []*types.Header // newest first
+	for h := head; ; {
+		num := h.Number.Uint64()
+		if b, ok := w.blocks[num]; ok && b.hash == h.Hash() {
+			break // already on our chain
+		}
+		branch = append(branch, h)
+		if len(w.blocks) == 0 || num == 0 {
+			break
+		}
+		parent, ok := w.blocks[num-1]
+		if ok && parent.hash == h.ParentHash {
+			break // connects to our chain
+		}
+		if !ok && num-1 < w.tip {
+			log.Printf("Reorg at block %d is deeper than %d blocks", num, reorgDepth)
+			break
+		}
+		if len(branch) >= reorgDepth {
+			w.skipGap(num)
+			break
+		}
+
+		var err error
+		if h, err = client.HeaderByHash(ctx, h.ParentHash); err != nil {
+			return fmt.Errorf("block %d parent: %w", num, err)
+		}
+	}
+	if len(branch) == 0 {
+		return nil
+	}
+
+	// Retract every block at or above the fork point, newest first.
+	fork := branch[len(branch)-1].Number.Uint64()
+	if _, ok := w.blocks[fork]; ok {
+		log.Printf("Reorg: blocks %d-%d replaced", fork, w.tip)
+	}
+	for num := w.tip; num >= fork && len(w.blocks) > 0; num-- {
+		if b, ok := w.blocks[num]; ok {
+			printMessages(w.chain, num, b.time, "reorged out, retracted", filterKeywords(b.found, w.keywords))
+			if err := w.store.Delete(ctx, b.found); err != nil {
+				log.Printf("Store error: %v", err)
+			}
+			delete(w.blocks, num)
+		}
+		if num == 0 {
+			break
+		}
+	}
+
+	// Emit the new branch, oldest first.
+	for i := len(branch) - 1; i >= 0; i-- {
+		block, err := client.BlockByHash(ctx, branch[i].Hash())
+		if err != nil {
+			return fmt.Errorf("block %d: %w", branch[i].Number.Uint64(), err)
+		}
+		w.emit(ctx, block)
+	}
+
+	if err := w.store.SetCheckpoint(ctx, w.tip); err != nil {
+		log.Printf("Checkpoint error: %v", err)
+	}
+
+	// Forget blocks too old to be reorged out.
+	for num := range w.blocks {
+		if num+reorgDepth <= w.tip {
+			delete(w.blocks, num)
+		}
+	}
+	return nil
+}
+
+// emit scans block, which extends the watcher's chain, and prints and stores
+// its messages.
+func (w *watcher) emit(ctx context.Context, block *types.Block) {
+	found := w.scanner.ScanBlock(ctx, block)
+	if ctx.Err() != nil {
+		return // stopping, and the block may have been scanned only in part
+	}
+	var parentTime uint64
+	if parent, ok := w.blocks[block.NumberU64()-1]; ok {
+		parentTime = parent.time
+	}
+	anomaly := timestampAnomaly(block.Time(), parentTime, time.Now(), w.maxSkew)
+	if anomaly != "" {
+		log.Printf("Block %d %s", block.NumberU64(), anomaly)
+	}
+	printMessages(w.chain, block.NumberU64(), block.Time(), anomaly, filterKeywords(found, w.keywords))
+	if err := saveMessages(ctx, w.store, found); err != nil {
+		log.Printf("Store error: %v", err)
+	}
+	if err := w.store.AddCoverage(ctx, block.NumberU64(), block.NumberU64(), w.scanner.Provenance); err != nil {
+		log.Printf("Coverage error: %v", err)
+	}
+	w.blocks[block.NumberU64()] = &watchedBlock{hash: block.Hash(), time: block.Time(), found: found}
+	w.tip = block.NumberU64()
+}
+
+// skipGap records the blocks between the current tip and num, which were
+// missed while disconnected and are too many to walk back through, in the
+// skipped-block ledger so that repair can pick them up.
+func (w *watcher) skipGap(num uint64) {
+	log.Printf("Missed blocks %d-%d while disconnected", w.tip+1, num-1)
+	for missed := w.tip + 1; missed < num; missed++ {
+		if err := appendSkipped(w.chain.file(skippedFile), int64(missed), errors.New("missed by watch mode")); err != nil {
+			log.Printf("Ledger save error: %v", err)
+			return
+		}
+	}
+	// The walk stops here, so nothing below num connects to the new branch.
+	for n := range w.blocks {
+		delete(w.blocks, n)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/krbreyn/txmsg-r/txmsg"
+)
+
+// branchChain serves blocks by hash, across every branch added to it.
+type branchChain map[common.Hash]*types.Block
+
+// extend adds blocks on top of parent, one per text ("" for an empty block),
+// and returns them.
+func (c branchChain) extend(t *testing.T, parent *types.Block, texts ...string) []*types.Block {
+	var blocks []*types.Block
+	for _, text := range texts {
+		var b *types.Block
+		if text == "" {
+			b = testBlock(t, parent.Number().Int64()+1, parent.Hash(), testKey)
+		} else {
+			b = testBlock(t, parent.Number().Int64()+1, parent.Hash(), testKey, text)
+		}
+		c[b.Hash()] = b
+		blocks = append(blocks, b)
+		parent = b
+	}
+	return blocks
+}
+
+// HeaderByHash implements headReader.
+func (c branchChain) HeaderByHash(_ context.Context, hash common.Hash) (*types.Header, error) {
+	b, ok := c[hash]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b.Header(), nil
+}
+
+// BlockByHash implements headReader.
+func (c branchChain) BlockByHash(_ context.Context, hash common.Hash) (*types.Block, error) {
+	b, ok := c[hash]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b, nil
+}
+
+func newTestWatcher(t *testing.T) *watcher {
+	return &watcher{
+		chain:   &Chain{Name: "mainnet"},
+		scanner: txmsg.NewScanner(),
+		store:   testStore(t),
+		blocks:  make(map[uint64]*watchedBlock),
+	}
+}
+
+func TestWatchReorg(t *testing.T) {
+	ctx := context.Background()
+	chain := make(branchChain)
+	genesis := testBlock(t, 0, common.Hash{}, testKey)
+	chain[genesis.Hash()] = genesis
+	old := chain.extend(t, genesis, "", "a message on the old branch here", "")
+	w := newTestWatcher(t)
+
+	// Start at block 1, then skip a head: block 3 fills in block 2.
+	for _, b := range []*types.Block{old[0], old[2]} {
+		if err := w.handleHead(ctx, chain, b.Header()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := storedTexts(t, w.store, 0, 10); !slices.Equal(got, []string{"a message on the old branch here"}) {
+		t.Fatalf("stored %q before the reorg", got)
+	}
+
+	// A longer branch forking after block 1 replaces blocks 2 and 3.
+	fork := chain.extend(t, old[0], "a message on the new branch here", "", "")
+	if err := w.handleHead(ctx, chain, fork[2].Header()); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedTexts(t, w.store, 0, 10); !slices.Equal(got, []string{"a message on the new branch here"}) {
+		t.Errorf("stored %q after the reorg, want only the new branch's message", got)
+	}
+	if w.tip != 4 {
+		t.Errorf("tip = %d, want 4", w.tip)
+	}
+	for i, b := range append(old[:1], fork...) {
+		if got := w.blocks[b.NumberU64()]; got == nil || got.hash != b.Hash() {
+			t.Errorf("block %d isn't the canonical one", i+1)
+		}
+	}
+	if block, ok, err := w.store.Checkpoint(ctx); err != nil || !ok || block != 4 {
+		t.Errorf("checkpoint = %d, %v, %v; want 4", block, ok, err)
+	}
+
+	// A head already on the chain changes nothing.
+	if err := w.handleHead(ctx, chain, fork[1].Header()); err != nil {
+		t.Fatal(err)
+	}
+	if w.tip != 4 {
+		t.Errorf("tip = %d after an old head, want 4", w.tip)
+	}
+}
+
+func TestWatchGapTooDeep(t *testing.T) {
+	inTempDir(t)
+	ctx := context.Background()
+	chain := make(branchChain)
+	genesis := testBlock(t, 0, common.Hash{}, testKey)
+	chain[genesis.Hash()] = genesis
+	blocks := chain.extend(t, genesis, make([]string, reorgDepth+5)...)
+	w := newTestWatcher(t)
+
+	if err := w.handleHead(ctx, chain, blocks[0].Header()); err != nil {
+		t.Fatal(err)
+	}
+	head := blocks[len(blocks)-1]
+	if err := w.handleHead(ctx, chain, head.Header()); err != nil {
+		t.Fatal(err)
+	}
+	if w.tip != head.NumberU64() {
+		t.Errorf("tip = %d, want %d", w.tip, head.NumberU64())
+	}
+
+	// Blocks the walk back didn't reach go to the ledger for repair.
+	ledger, err := readSkipped(w.chain.file(skippedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := uint64(2), head.NumberU64()-reorgDepth
+	if len(ledger) != int(last-first+1) || ledger[0].Block != int64(first) || ledger[len(ledger)-1].Block != int64(last) {
+		t.Errorf("ledger holds %d blocks, want %d-%d", len(ledger), first, last)
+	}
+}